@@ -26,6 +26,7 @@ const (
 	statusAdmin     = 20
 )
 
+// apigen:service {"prefix": "/user"}
 type MyApi struct {
 	statuses map[string]int
 	users    map[string]*User
@@ -75,7 +76,7 @@ type NewUser struct {
 	ID uint64 `json:"id"`
 }
 
-// apigen:api {"url": "/user/profile", "auth": false}
+// apigen:api {"url": "/profile", "auth": false}
 func (srv *MyApi) Profile(ctx context.Context, in ProfileParams) (*User, error) {
 
 	if in.Login == "bad_user" {
@@ -92,7 +93,7 @@ func (srv *MyApi) Profile(ctx context.Context, in ProfileParams) (*User, error)
 	return user, nil
 }
 
-// apigen:api {"url": "/user/create", "auth": true, "method": "POST"}
+// apigen:api {"url": "/create", "auth": true, "method": "POST", "idempotent": true, "timeout": "500ms"}
 func (srv *MyApi) Create(ctx context.Context, in CreateParams) (*NewUser, error) {
 	if in.Login == "bad_username" {
 		return nil, fmt.Errorf("bad user")
@@ -153,3 +154,40 @@ func (srv *OtherApi) Create(ctx context.Context, in OtherCreateParams) (*OtherUs
 		Level:    in.Level,
 	}, nil
 }
+
+// VersionedApi is OtherApi mounted only under /v1 and /v2, the config is shared by all its methods
+// apigen:service {"prefix": "/user", "auth": true, "versions": ["v1", "v2"]}
+type VersionedApi struct {
+}
+
+func NewVersionedApi() *VersionedApi {
+	return &VersionedApi{}
+}
+
+// apigen:api {"url": "/create", "method": "POST"}
+func (srv *VersionedApi) Create(ctx context.Context, in OtherCreateParams) (*OtherUser, error) {
+	return &OtherUser{
+		ID:       12,
+		Login:    in.Username,
+		FullName: in.Name,
+		Level:    in.Level,
+	}, nil
+}
+
+type EquipParams struct {
+	Class string `apivalidator:"enum=warrior|sorcerer|rouge,default=warrior"`
+	Slot  string `apivalidator:"paramname=item_slot,enum=head|hands|feet,default=head"`
+}
+
+type Equipment struct {
+	Class string `json:"class"`
+	Slot  string `json:"slot"`
+}
+
+// apigen:api {"url": "/equip", "method": "POST"}
+func (srv *VersionedApi) Equip(ctx context.Context, in EquipParams) (*Equipment, error) {
+	return &Equipment{
+		Class: in.Class,
+		Slot:  in.Slot,
+	}, nil
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 type response struct {
 	Error    string      `json:"error"`
@@ -29,6 +34,213 @@ func writeResponseJSON(w http.ResponseWriter, status int, data interface{}, erro
 	}
 }
 
+type methodResult struct {
+	resp interface{}
+	err  error
+}
+
+// callWithTimeout runs the method with a deadline. The method gets no access to the response writer,
+// so a method abandoned after the deadline can't write anything to the response.
+// If abandoned is set, it gets the channel the result of the abandoned method is sent to.
+func callWithTimeout(parent context.Context, timeout time.Duration, call func(ctx context.Context) (interface{}, error), abandoned func(result <-chan methodResult)) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	// buffered, so the abandoned method doesn't block forever
+	resultCh := make(chan methodResult, 1)
+	go func() {
+		resp, err := call(ctx)
+		resultCh <- methodResult{resp, err}
+	}()
+
+	select {
+	case res := <-resultCh:
+		return res.resp, res.err
+	case <-ctx.Done():
+		if abandoned != nil {
+			abandoned(resultCh)
+		}
+		return nil, ApiError{http.StatusGatewayTimeout, ctx.Err()}
+	}
+}
+
+// IdempotentResponse is a response saved for an Idempotency-Key
+type IdempotentResponse struct {
+	Fingerprint string
+	Status      int
+	Body        []byte
+}
+
+// IdempotencyStore keeps responses of idempotent endpoints, so retried requests can be replayed
+type IdempotencyStore interface {
+	// Reserve returns the saved response of the key. If there is none, the key is reserved
+	// by the caller until Set or Release and reserved is true. If another request holds the key,
+	// both results are empty.
+	Reserve(key string) (resp *IdempotentResponse, reserved bool)
+	// Set saves the response of the reserved key
+	Set(key string, resp *IdempotentResponse)
+	// Release frees the reserved key without a response, so the request can be retried
+	Release(key string)
+}
+
+// DefaultIdempotencyStore is used by generated handlers, replace it to share responses between instances
+var DefaultIdempotencyStore IdempotencyStore = NewMemoryIdempotencyStore(24 * time.Hour)
+
+// memoryIdempotencyEntry without resp is a reserved key, its request is in flight
+type memoryIdempotencyEntry struct {
+	resp      *IdempotentResponse
+	expiresAt time.Time
+}
+
+type MemoryIdempotencyStore struct {
+	ttl       time.Duration
+	entries   map[string]memoryIdempotencyEntry
+	nextSweep time.Time
+	mu        *sync.Mutex
+}
+
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		ttl:       ttl,
+		entries:   make(map[string]memoryIdempotencyEntry),
+		nextSweep: time.Now().Add(ttl),
+		mu:        &sync.Mutex{},
+	}
+}
+
+func (s *MemoryIdempotencyStore) Reserve(key string) (*IdempotentResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	entry, ok := s.entries[key]
+	if ok && now.Before(entry.expiresAt) {
+		return entry.resp, false
+	}
+
+	s.entries[key] = memoryIdempotencyEntry{expiresAt: now.Add(s.ttl)}
+	return nil, true
+}
+
+func (s *MemoryIdempotencyStore) Set(key string, resp *IdempotentResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = memoryIdempotencyEntry{
+		resp:      resp,
+		expiresAt: time.Now().Add(s.ttl),
+	}
+}
+
+func (s *MemoryIdempotencyStore) Release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[key]; ok && entry.resp == nil {
+		delete(s.entries, key)
+	}
+}
+
+// sweep deletes expired entries at most once per ttl, so a request doesn't pay for the whole map
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+
+	for k, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	s.nextSweep = now.Add(s.ttl)
+}
+
+// requestFingerprint identifies request params, form values are encoded sorted by key
+func requestFingerprint(r *http.Request) string {
+	r.ParseForm()
+	sum := sha256.Sum256([]byte(r.Form.Encode()))
+	return hex.EncodeToString(sum[:])
+}
+
+// idempotencyRecorder keeps a copy of the response to save it after the handler finishes.
+// called is set right before the method runs, responses of failed validation are not saved.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	store       IdempotencyStore
+	key         string
+	fingerprint string
+	status      int
+	body        []byte
+	called      bool
+	abandoned   bool
+}
+
+func (rec *idempotencyRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *idempotencyRecorder) Write(data []byte) (int, error) {
+	rec.body = append(rec.body, data...)
+	return rec.ResponseWriter.Write(data)
+}
+
+// finish saves the response when the handler returns, the key of an abandoned method stays reserved
+func (rec *idempotencyRecorder) finish() {
+	if rec.abandoned {
+		return
+	}
+	if !rec.called {
+		rec.store.Release(rec.key)
+		return
+	}
+	rec.save(rec.status, rec.body)
+}
+
+// abandon saves the result of the method which returns after the deadline, so a retry doesn't run it again
+func (rec *idempotencyRecorder) abandon(result <-chan methodResult) {
+	rec.abandoned = true
+	go func() {
+		res := <-result
+		status, body := methodResponse(res.resp, res.err)
+		rec.save(status, body)
+	}()
+}
+
+func (rec *idempotencyRecorder) save(status int, body []byte) {
+	// server errors are not saved, so the request can be retried
+	if status >= http.StatusInternalServerError {
+		rec.store.Release(rec.key)
+		return
+	}
+
+	rec.store.Set(rec.key, &IdempotentResponse{
+		Fingerprint: rec.fingerprint,
+		Status:      status,
+		Body:        body,
+	})
+}
+
+// methodResponse is the response the handler writes for the result of the method
+func methodResponse(resp interface{}, err error) (int, []byte) {
+	status, errorText := http.StatusOK, ""
+	if err != nil {
+		resp = nil
+		status, errorText = http.StatusInternalServerError, err.Error()
+		if apiErr, ok := err.(ApiError); ok {
+			status, errorText = apiErr.HTTPStatus, apiErr.Err.Error()
+		}
+	}
+
+	body, err := json.Marshal(response{Error: errorText, Response: resp})
+	if err != nil {
+		return http.StatusInternalServerError, []byte(err.Error())
+	}
+	return status, body
+}
+
 func (srv *MyApi) wrapperProfile(w http.ResponseWriter, r *http.Request) {
 	var Login string
 
@@ -74,6 +286,35 @@ func (srv *MyApi) wrapperCreate(w http.ResponseWriter, r *http.Request) {
 		writeResponseJSON(w, http.StatusForbidden, nil, "unauthorized")
 		return
 	}
+
+	var idempotencyRec *idempotencyRecorder
+	if idempotencyKey := r.Header.Get("Idempotency-Key"); idempotencyKey != "" {
+		storeKey := "MyApi.Create:" + idempotencyKey
+		fingerprint := requestFingerprint(r)
+
+		store := DefaultIdempotencyStore
+		saved, reserved := store.Reserve(storeKey)
+		if saved != nil {
+			if saved.Fingerprint != fingerprint {
+				writeResponseJSON(w, http.StatusUnprocessableEntity, nil, "idempotency key is already used with different params")
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(saved.Status)
+			w.Write(saved.Body)
+			return
+		}
+		if !reserved {
+			writeResponseJSON(w, http.StatusConflict, nil, "request with this idempotency key is in progress")
+			return
+		}
+
+		idempotencyRec = &idempotencyRecorder{ResponseWriter: w, store: store, key: storeKey, fingerprint: fingerprint, status: http.StatusOK}
+		defer idempotencyRec.finish()
+		w = idempotencyRec
+	}
 	var Login string
 	var Name string
 	var Status string
@@ -99,17 +340,10 @@ func (srv *MyApi) wrapperCreate(w http.ResponseWriter, r *http.Request) {
 	if Status == "" {
 		Status = "user"
 	}
-	statusList := []string{"user", "moderator", "admin"}
-	isStatusValid := false
-	for _, item := range statusList {
-		if item == Status {
-			isStatusValid = true
-				break
-		}
-	}
-
-	if !isStatusValid {
-		writeResponseJSON(w, http.StatusBadRequest, nil, fmt.Sprintf("status must be one of [%s]", strings.Join(statusList, ", ")))
+	
+	StatusEnum := map[string]bool{"user": true, "moderator": true, "admin": true}
+	if !StatusEnum[Status] {
+		writeResponseJSON(w, http.StatusBadRequest, nil, "status must be one of [user, moderator, admin]")
 		return
 	}
 
@@ -140,7 +374,17 @@ func (srv *MyApi) wrapperCreate(w http.ResponseWriter, r *http.Request) {
 		Age: AgeInt,
 	}
 	
-	resp, err := srv.Create(r.Context(), paramsToPass)
+	if idempotencyRec != nil {
+		idempotencyRec.called = true
+	}
+	// timeout 500ms
+	var abandoned func(result <-chan methodResult)
+	if idempotencyRec != nil {
+		abandoned = idempotencyRec.abandon
+	}
+	resp, err := callWithTimeout(r.Context(), time.Duration(500000000), func(ctx context.Context) (interface{}, error) {
+		return srv.Create(ctx, paramsToPass)
+	}, abandoned)
 	if err != nil {
 		apiErr, ok := err.(ApiError)
 		if ok {
@@ -190,17 +434,90 @@ func (srv *OtherApi) wrapperCreate(w http.ResponseWriter, r *http.Request) {
 	if Class == "" {
 		Class = "warrior"
 	}
-	statusList := []string{"warrior", "sorcerer", "rouge"}
-	isStatusValid := false
-	for _, item := range statusList {
-		if item == Class {
-			isStatusValid = true
-				break
+	
+	ClassEnum := map[string]bool{"warrior": true, "sorcerer": true, "rouge": true}
+	if !ClassEnum[Class] {
+		writeResponseJSON(w, http.StatusBadRequest, nil, "class must be one of [warrior, sorcerer, rouge]")
+		return
+	}
+
+	LevelInt, err := strconv.Atoi(Level)
+	if err != nil {
+		writeResponseJSON(w, http.StatusBadRequest, nil, strings.ToLower("Level must be int"))
+		return
+	}
+	
+	if LevelInt < 1 {
+		writeResponseJSON(w, http.StatusBadRequest, nil, strings.ToLower("Level must be >= 1"))
+		return
+	}
+	
+	if LevelInt > 50 {
+		writeResponseJSON(w, http.StatusBadRequest, nil, strings.ToLower("Level must be <= 50"))
+		return
+	}
+	
+	paramsToPass := OtherCreateParams {
+		Username: Username,
+		Name: Name,
+		Class: Class,
+		Level: LevelInt,
+	}
+	
+	resp, err := srv.Create(r.Context(), paramsToPass)
+	if err != nil {
+		apiErr, ok := err.(ApiError)
+		if ok {
+			writeResponseJSON(w, apiErr.HTTPStatus, nil, apiErr.Err.Error())
+			return
 		}
+
+		writeResponseJSON(w, http.StatusInternalServerError, nil, err.Error())
+		return
 	}
 
-	if !isStatusValid {
-		writeResponseJSON(w, http.StatusBadRequest, nil, fmt.Sprintf("status must be one of [%s]", strings.Join(statusList, ", ")))
+	writeResponseJSON(w, http.StatusOK, resp, "")
+}
+
+func (srv *VersionedApi) wrapperCreate(w http.ResponseWriter, r *http.Request) {	
+	if r.Method != http.MethodPost {
+		writeResponseJSON(w, http.StatusNotAcceptable, nil, "bad method")
+		return
+	}
+	
+	if r.Header.Get("X-Auth") != "100500" {
+		writeResponseJSON(w, http.StatusForbidden, nil, "unauthorized")
+		return
+	}
+	var Username string
+	var Name string
+	var Class string
+	var Level string
+
+	if r.Method == http.MethodPost {
+       Username = r.FormValue(`username`)
+       Name = r.FormValue(`account_name`)
+       Class = r.FormValue(`class`)
+       Level = r.FormValue(`level`)
+    }
+
+	if Username == "" {
+		writeResponseJSON(w, http.StatusBadRequest, nil, "username must me not empty")
+		return
+	}
+	
+	if len(Username) < 3 {
+		writeResponseJSON(w, http.StatusBadRequest, nil, strings.ToLower("Username len must be >= 3"))
+		return
+	}
+	
+	if Class == "" {
+		Class = "warrior"
+	}
+	
+	ClassEnum := map[string]bool{"warrior": true, "sorcerer": true, "rouge": true}
+	if !ClassEnum[Class] {
+		writeResponseJSON(w, http.StatusBadRequest, nil, "class must be one of [warrior, sorcerer, rouge]")
 		return
 	}
 
@@ -242,6 +559,64 @@ func (srv *OtherApi) wrapperCreate(w http.ResponseWriter, r *http.Request) {
 	writeResponseJSON(w, http.StatusOK, resp, "")
 }
 
+func (srv *VersionedApi) wrapperEquip(w http.ResponseWriter, r *http.Request) {	
+	if r.Method != http.MethodPost {
+		writeResponseJSON(w, http.StatusNotAcceptable, nil, "bad method")
+		return
+	}
+	
+	if r.Header.Get("X-Auth") != "100500" {
+		writeResponseJSON(w, http.StatusForbidden, nil, "unauthorized")
+		return
+	}
+	var Class string
+	var Slot string
+
+	if r.Method == http.MethodPost {
+       Class = r.FormValue(`class`)
+       Slot = r.FormValue(`item_slot`)
+    }
+
+	if Class == "" {
+		Class = "warrior"
+	}
+	
+	ClassEnum := map[string]bool{"warrior": true, "sorcerer": true, "rouge": true}
+	if !ClassEnum[Class] {
+		writeResponseJSON(w, http.StatusBadRequest, nil, "class must be one of [warrior, sorcerer, rouge]")
+		return
+	}
+
+	if Slot == "" {
+		Slot = "head"
+	}
+	
+	SlotEnum := map[string]bool{"head": true, "hands": true, "feet": true}
+	if !SlotEnum[Slot] {
+		writeResponseJSON(w, http.StatusBadRequest, nil, "item_slot must be one of [head, hands, feet]")
+		return
+	}
+
+	paramsToPass := EquipParams {
+		Class: Class,
+		Slot: Slot,
+	}
+	
+	resp, err := srv.Equip(r.Context(), paramsToPass)
+	if err != nil {
+		apiErr, ok := err.(ApiError)
+		if ok {
+			writeResponseJSON(w, apiErr.HTTPStatus, nil, apiErr.Err.Error())
+			return
+		}
+
+		writeResponseJSON(w, http.StatusInternalServerError, nil, err.Error())
+		return
+	}
+
+	writeResponseJSON(w, http.StatusOK, resp, "")
+}
+
 func (srv *MyApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.URL.Path { 
 		case "/user/profile":
@@ -261,3 +636,14 @@ func (srv *OtherApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			writeResponseJSON(w, http.StatusNotFound, nil, "unknown method")
 		}
 }
+
+func (srv *VersionedApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path { 
+		case "/v1/user/create", "/v2/user/create":
+			srv.wrapperCreate(w, r)
+		case "/v1/user/equip", "/v2/user/equip":
+			srv.wrapperEquip(w, r)
+		default:
+			writeResponseJSON(w, http.StatusNotFound, nil, "unknown method")
+		}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// apiRequest is what the fake api got from the client
+type apiRequest struct {
+	Method         string
+	Path           string
+	Params         url.Values
+	Auth           string
+	IdempotencyKey string
+}
+
+type CliCase struct {
+	Args    []string
+	Status  int    // status of the fake api response
+	Body    string // body of the fake api response
+	Request *apiRequest
+	Code    int
+	Stdout  string
+	Stderr  string
+}
+
+func TestCli(t *testing.T) {
+	var status int
+	var body string
+	var got *apiRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		got = &apiRequest{
+			Method:         r.Method,
+			Path:           r.URL.Path,
+			Params:         r.Form,
+			Auth:           r.Header.Get("X-Auth"),
+			IdempotencyKey: r.Header.Get("Idempotency-Key"),
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	defer ts.Close()
+
+	cases := []CliCase{
+		CliCase{ // GET, the idempotency key is sent only to idempotent methods
+			Args:   []string{"-idempotency-key", "k1", "user", "profile", "-login", "rvasily"},
+			Status: http.StatusOK,
+			Body:   `{"error":"","response":{"id":42,"login":"rvasily"}}`,
+			Request: &apiRequest{
+				Method: http.MethodGet,
+				Path:   "/user/profile",
+				Params: url.Values{"login": {"rvasily"}},
+			},
+			Code:   0,
+			Stdout: `{"id":42,"login":"rvasily"}` + "\n",
+		},
+		CliCase{ // POST with defaults, auth and the idempotency key
+			Args:   []string{"-auth", "100500", "-idempotency-key", "k2", "user", "create", "-login", "new_moderator", "-status", "moderator", "-age", "0"},
+			Status: http.StatusOK,
+			Body:   `{"error":"","response":{"id":43}}`,
+			Request: &apiRequest{
+				Method:         http.MethodPost,
+				Path:           "/user/create",
+				Params:         url.Values{"login": {"new_moderator"}, "full_name": {""}, "status": {"moderator"}, "age": {"3"}},
+				Auth:           "100500",
+				IdempotencyKey: "k2",
+			},
+			Code:   0,
+			Stdout: `{"id":43}` + "\n",
+		},
+		CliCase{
+			Args:   []string{"user", "profile", "-login", "unknown"},
+			Status: http.StatusNotFound,
+			Body:   `{"error":"user not exist"}`,
+			Request: &apiRequest{
+				Method: http.MethodGet,
+				Path:   "/user/profile",
+				Params: url.Values{"login": {"unknown"}},
+			},
+			Code:   4,
+			Stderr: "user not exist\n",
+		},
+		CliCase{
+			Args:   []string{"user", "profile", "-login", "bad_user"},
+			Status: http.StatusInternalServerError,
+			Body:   `{"error":"bad user"}`,
+			Request: &apiRequest{
+				Method: http.MethodGet,
+				Path:   "/user/profile",
+				Params: url.Values{"login": {"bad_user"}},
+			},
+			Code:   5,
+			Stderr: "bad user\n",
+		},
+		CliCase{ // not an api response
+			Args:   []string{"user", "profile", "-login", "rvasily"},
+			Status: http.StatusOK,
+			Body:   `oops`,
+			Request: &apiRequest{
+				Method: http.MethodGet,
+				Path:   "/user/profile",
+				Params: url.Values{"login": {"rvasily"}},
+			},
+			Code:   1,
+			Stderr: "can't unpack response \"oops\": invalid character 'o' looking for beginning of value\n",
+		},
+		CliCase{ // params are checked before the request
+			Args:   []string{"user", "create", "-login", "short"},
+			Code:   2,
+			Stderr: "login len must be >= 10\n",
+		},
+		CliCase{
+			Args:   []string{"user", "create", "-login", "new_moderator", "-age", "old"},
+			Code:   2,
+			Stderr: "age must be int\n",
+		},
+		CliCase{
+			Args:   []string{"user", "create", "-login", "new_moderator", "-status", "root"},
+			Code:   2,
+			Stderr: "status must be one of [user, moderator, admin]\n",
+		},
+		CliCase{
+			Args: []string{"user", "delete"},
+			Code: 2,
+		},
+		CliCase{
+			Args: []string{"-unknown", "user", "profile"},
+			Code: 2,
+		},
+		CliCase{
+			Args: []string{"-h"},
+			Code: 0,
+		},
+	}
+
+	for idx, item := range cases {
+		caseName := fmt.Sprintf("case %d: %s", idx, strings.Join(item.Args, " "))
+		status, body, got = item.Status, item.Body, nil
+
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		code := run(append([]string{"-addr", ts.URL}, item.Args...), stdout, stderr)
+
+		if code != item.Code {
+			t.Errorf("[%s] expected exit code %d, got %d, stderr: %s", caseName, item.Code, code, stderr)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(item.Request) {
+			t.Errorf("[%s] requests not match\nGot: %+v\nExpected: %+v", caseName, got, item.Request)
+		}
+		if stdout.String() != item.Stdout {
+			t.Errorf("[%s] expected stdout %q, got %q", caseName, item.Stdout, stdout)
+		}
+		// usage is long, only errors are compared
+		if item.Stderr != "" && stderr.String() != item.Stderr {
+			t.Errorf("[%s] expected stderr %q, got %q", caseName, item.Stderr, stderr)
+		}
+	}
+}
+
+func TestCliUnreachable(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+
+	stderr := &bytes.Buffer{}
+	code := run([]string{"-addr", ts.URL, "user", "profile", "-login", "rvasily"}, &bytes.Buffer{}, stderr)
+	if code != 1 || stderr.Len() == 0 {
+		t.Errorf("expected exit code 1 with an error, got %d %q", code, stderr)
+	}
+}
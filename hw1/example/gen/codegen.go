@@ -1,128 +1,601 @@
-// go build gen/* && ./codegen.exe pack/unpack.go  pack/marshaller.go
+// go build gen/* && ./codegen.exe [-v] [-maxlen 1048576] [-schema pack/layout.json] [-ksy pack/layout.ksy] pack/unpack.go  pack/marshaller.go
+// or for whole packages: ./codegen.exe [-o binpack_generated.go] ./...
 // go run pack/*
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
 	"go/ast"
+	"go/format"
 	"go/parser"
 	"go/token"
+	"go/types"
+	"io/ioutil"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 	"text/template"
+
+	"golang.org/x/tools/go/packages"
 )
 
 type tpl struct {
-	FieldName string
+	StructName string
+}
+
+type optionsTplModel struct {
+	StructName string
+	Options    string
 }
 
 var (
-	intTpl = template.Must(template.New("intTpl").Parse(`
-	// {{.FieldName}}
-	var {{.FieldName}}Raw uint32
-	binary.Read(r, binary.LittleEndian, &{{.FieldName}}Raw)
-	in.{{.FieldName}} = int({{.FieldName}}Raw)
+	maxLen      = flag.Int64("maxlen", 1<<20, "max length of strings, can be overridden per field with `cgen:\"max=N\"`")
+	schemaFile  = flag.String("schema", "", "write the JSON description of the wire layout to the file")
+	ksyFile     = flag.String("ksy", "", "write the Kaitai Struct description of the wire layout to the file")
+	maxFrameLen = flag.Int64("maxframe", 16<<20, "max payload length of frames")
+	outName     = flag.String("o", "binpack_generated.go", "name of the generated file in every package")
+	verbose     = flag.Bool("v", false, "print which structs and fields are generated or skipped")
+)
+
+var (
+	// binpackError keeps the struct and field names, so it's clear where the payload is broken
+	helpersTpl = template.Must(template.New("helpersTpl").Parse(`
+func binpackError(structName, fieldName string, err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("%s.%s: %w", structName, fieldName, err)
+}
+
+var errBinpackVarintOverflow = errors.New("varint overflows a 64-bit integer")
+
+// binpackReader decodes from a byte slice or, if src is set, from a stream
+type binpackReader struct {
+	data []byte
+	src  io.Reader
+	buf  []byte // reused for stream reads
+	read int
+}
+
+// binpackScratch keeps buffers for stream reads, the buffer is passed to io.Reader,
+// so it can't stay on the stack and would be allocated by every UnpackFrom
+var binpackScratch = sync.Pool{
+	New: func() interface{} {
+		return new([64]byte)
+	},
+}
+
+// binpackStreamPrealloc limits slices made before their elements are read from a stream,
+// the stream may end long before the length it claims
+const binpackStreamPrealloc = 1024
+
+// next returns n bytes, in stream mode they are valid only until the next call
+func (r *binpackReader) next(n int) ([]byte, error) {
+	if r.src == nil {
+		if len(r.data) < n {
+			return nil, io.ErrUnexpectedEOF
+		}
+		b := r.data[:n]
+		r.data = r.data[n:]
+		return b, nil
+	}
+
+	if cap(r.buf) < n {
+		size := 64
+		for size < n {
+			size *= 2
+		}
+		r.buf = make([]byte, size)
+	}
+	b := r.buf[:n]
+	read, err := io.ReadFull(r.src, b)
+	r.read += read
+	return b, err
+}
+
+// remaining is the amount of bytes left, streams don't know it
+func (r *binpackReader) remaining() int {
+	if r.src == nil {
+		return len(r.data)
+	}
+	return math.MaxInt
+}
+
+// prealloc is the capacity of a slice of n elements, byte slices are already checked to hold them,
+// slices read from streams grow as their elements are read
+func (r *binpackReader) prealloc(n uint64) int {
+	if r.src != nil && n > binpackStreamPrealloc {
+		return binpackStreamPrealloc
+	}
+	return int(n)
+}
+
+func (r *binpackReader) uvarint() (uint64, error) {
+	var x uint64
+	var s uint
+	for i := 0; i < binary.MaxVarintLen64; i++ {
+		b, err := r.next(1)
+		if err != nil {
+			return 0, err
+		}
+		if b[0] < 0x80 {
+			if i == binary.MaxVarintLen64-1 && b[0] > 1 {
+				return 0, errBinpackVarintOverflow
+			}
+			return x | uint64(b[0])<<s, nil
+		}
+		x |= uint64(b[0]&0x7f) << s
+		s += 7
+	}
+	return 0, errBinpackVarintOverflow
+}
+
+// binpackInsertLen inserts the uvarint length of b[start:] before it
+func binpackInsertLen(b []byte, start int) []byte {
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(b)-start))
+	b = append(b, prefix[:n]...)
+	copy(b[start+n:], b[start:len(b)-n])
+	copy(b[start:], prefix[:n])
+	return b
+}
+
+func (r *binpackReader) varint() (int64, error) {
+	ux, err := r.uvarint()
+	x := int64(ux >> 1)
+	if ux&1 != 0 {
+		x = ^x
+	}
+	return x, err
+}
+`))
+
+	methodsTpl = template.Must(template.New("methodsTpl").Parse(`
+func (in *{{.StructName}}) Unpack(data []byte) error {
+	return in.unpack(&binpackReader{data: data})
+}
+
+// UnpackFrom reads exactly one {{.StructName}} from the stream, io.EOF means the stream ended before it
+func (in *{{.StructName}}) UnpackFrom(r io.Reader) error {
+	scratch := binpackScratch.Get().(*[64]byte)
+	defer binpackScratch.Put(scratch)
+
+	br := binpackReader{src: r, buf: scratch[:]}
+	err := in.unpack(&br)
+	if br.read == 0 && errors.Is(err, io.ErrUnexpectedEOF) {
+		return io.EOF
+	}
+	return err
+}
+
+func (in *{{.StructName}}) Pack() ([]byte, error) {
+	return in.appendPack(nil)
+}
+
+// AppendPack appends packed {{.StructName}} to dst. It panics on values Pack rejects,
+// AppendBinary returns the error instead.
+func (in *{{.StructName}}) AppendPack(dst []byte) []byte {
+	b, err := in.appendPack(dst)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+`))
+
+	// the reflection codec in lib/pack can't read comments, so it gets struct options from here
+	optionsTpl = template.Must(template.New("optionsTpl").Parse(`
+// BinpackOptions returns options of the cgen comment
+func (in *{{.StructName}}) BinpackOptions() string {
+	return {{printf "%q" .Options}}
+}
+`))
+
+	binaryMarshalerTpl = template.Must(template.New("binaryMarshalerTpl").Parse(`
+// MarshalBinary implements encoding.BinaryMarshaler
+func (in *{{.StructName}}) MarshalBinary() ([]byte, error) {
+	return in.Pack()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+func (in *{{.StructName}}) UnmarshalBinary(data []byte) error {
+	return in.Unpack(data)
+}
+
+// AppendBinary implements encoding.BinaryAppender, dst is returned as is on error
+func (in *{{.StructName}}) AppendBinary(dst []byte) ([]byte, error) {
+	b, err := in.appendPack(dst)
+	if err != nil {
+		return dst, err
+	}
+	return b, nil
+}
+
+`))
+
+	fuzzHeaderTpl = template.Must(template.New("fuzzHeaderTpl").Parse(`// Code generated by codegen. DO NOT EDIT.
+
+package {{.}}
+
+import (
+	"bytes"
+	"testing"
+)
 `))
 
-	strTpl = template.Must(template.New("strTpl").Parse(`
-	// {{.FieldName}}
-	var {{.FieldName}}LenRaw uint32
-	binary.Read(r, binary.LittleEndian, &{{.FieldName}}LenRaw)
-	{{.FieldName}}Raw := make([]byte, {{.FieldName}}LenRaw)
-	binary.Read(r, binary.LittleEndian, &{{.FieldName}}Raw)
-	in.{{.FieldName}} = string({{.FieldName}}Raw)
+	// packing the unpacked value and unpacking it again must give the same bytes
+	fuzzTpl = template.Must(template.New("fuzzTpl").Parse(`
+func Fuzz{{.StructName}}RoundTrip(f *testing.F) {
+	seed, err := (&{{.StructName}}{}).Pack()
+	if err != nil {
+		f.Fatalf("{{.StructName}}.Pack: %v", err)
+	}
+	f.Add(seed)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		in := &{{.StructName}}{}
+		if err := in.Unpack(data); err != nil {
+			return
+		}
+
+		packed, err := in.Pack()
+		if err != nil {
+			t.Fatalf("{{.StructName}}.Pack: %v", err)
+		}
+
+		out := &{{.StructName}}{}
+		if err := out.Unpack(packed); err != nil {
+			t.Fatalf("{{.StructName}}.Unpack: %v", err)
+		}
+
+		// the stream gives the same value and reads nothing after it
+		stream := bytes.NewReader(append(packed, 0xff))
+		streamed := &{{.StructName}}{}
+		if err := streamed.UnpackFrom(stream); err != nil {
+			t.Fatalf("{{.StructName}}.UnpackFrom: %v", err)
+		}
+		if stream.Len() != 1 {
+			t.Fatalf("{{.StructName}}.UnpackFrom left %d bytes, want 1", stream.Len())
+		}
+		if streamedPacked, err := streamed.Pack(); err != nil || !bytes.Equal(packed, streamedPacked) {
+			t.Fatalf("{{.StructName}}.UnpackFrom mismatch: %v\nwant: %v\ngot:  %v", err, packed, streamedPacked)
+		}
+
+		repacked, err := out.Pack()
+		if err != nil {
+			t.Fatalf("{{.StructName}}.Pack: %v", err)
+		}
+
+		if !bytes.Equal(packed, repacked) {
+			t.Fatalf("{{.StructName}} round trip mismatch\nfirst:  %v\nsecond: %v", packed, repacked)
+		}
+	})
+}
 `))
 )
 
+// binpackStruct is a struct marked with `// cgen: binpack`
+type binpackStruct struct {
+	Name   string
+	Node   *ast.StructType
+	Opts   binpackStructOpts
+	Fields []binpackField // filled during generation
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: codegen [flags] [packages]")
+	fmt.Fprintln(os.Stderr, "       codegen [flags] input.go output.go")
+	flag.PrintDefaults()
+}
+
+// logf prints progress, it's quiet unless -v is set
+func logf(format string, args ...interface{}) {
+	if *verbose {
+		fmt.Printf(format, args...)
+	}
+}
+
 func main() {
+	log.SetFlags(0)
+	log.SetPrefix("codegen: ")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *maxLen < 0 || *maxLen > math.MaxUint32 {
+		fmt.Fprintln(os.Stderr, "maxlen must be in range [0, 4294967295]")
+		os.Exit(2)
+	}
+	if *maxFrameLen < 0 || *maxFrameLen > math.MaxUint32 {
+		fmt.Fprintln(os.Stderr, "maxframe must be in range [0, 4294967295]")
+		os.Exit(2)
+	}
+
+	args := flag.Args()
 	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, os.Args[1], nil, parser.ParseComments)
+
+	// a single file, the way the generator was always run from this folder
+	if len(args) == 2 && strings.HasSuffix(args[0], ".go") && strings.HasSuffix(args[1], ".go") {
+		node, err := parser.ParseFile(fset, args[0], nil, parser.ParseComments)
+		if err != nil {
+			log.Fatal(err)
+		}
+		generate(fset, node.Name.Name, []*ast.File{node}, args[1], *schemaFile, *ksyFile)
+		return
+	}
+
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	cfg := &packages.Config{Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax, Fset: fset}
+	pkgs, err := packages.Load(cfg, args...)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if packages.PrintErrors(pkgs) > 0 {
+		os.Exit(1)
+	}
+
+	for _, pkg := range pkgs {
+		if len(pkg.GoFiles) == 0 {
+			continue
+		}
+		dir := filepath.Dir(pkg.GoFiles[0])
+		generate(fset, pkg.Name, pkg.Syntax, filepath.Join(dir, *outName), inDir(dir, *schemaFile), inDir(dir, *ksyFile))
+	}
+}
+
+// inDir resolves paths of per-package outputs against the package folder
+func inDir(dir, fileName string) string {
+	if fileName == "" || filepath.IsAbs(fileName) {
+		return fileName
+	}
+	return filepath.Join(dir, fileName)
+}
 
-	out, _ := os.Create(os.Args[2])
+// generate writes Pack and Unpack for all binpack structs of the package to a single file,
+// nothing is written if there are no such structs
+func generate(fset *token.FileSet, pkgName string, files []*ast.File, outFile, schemaFile, ksyFile string) {
+	// structs can be nested, so all of them are collected before generating the code
+	structs := make([]binpackStruct, 0)
+	binpackStructs := make(map[string]bool)
 
-	fmt.Fprintln(out, `package `+node.Name.Name)
-	fmt.Fprintln(out) // empty line
-	fmt.Fprintln(out, `import "encoding/binary"`)
-	fmt.Fprintln(out, `import "bytes"`)
-	fmt.Fprintln(out) // empty line
+	decls := make([]ast.Decl, 0)
+	for _, file := range files {
+		decls = append(decls, file.Decls...)
+	}
 
-	for _, f := range node.Decls {
+	for _, f := range decls {
 		g, ok := f.(*ast.GenDecl)
 		if !ok {
-			fmt.Printf("SKIP %T is not *ast.GenDecl\n", f)
+			logf("SKIP %T is not *ast.GenDecl\n", f)
 			continue
 		}
 	SPECS_LOOP:
 		for _, spec := range g.Specs {
 			currType, ok := spec.(*ast.TypeSpec)
 			if !ok {
-				fmt.Printf("SKIP %T is not ast.TypeSpec\n", spec)
+				logf("SKIP %T is not ast.TypeSpec\n", spec)
 				continue
 			}
 
 			currStruct, ok := currType.Type.(*ast.StructType)
 			if !ok {
-				fmt.Printf("SKIP %T is not ast.StructType\n", currStruct)
+				logf("SKIP %T is not ast.StructType\n", currStruct)
 				continue
 			}
 
 			if g.Doc == nil {
-				fmt.Printf("SKIP struct %#v doesnt have comments\n", currType.Name.Name)
+				logf("SKIP struct %#v doesnt have comments\n", currType.Name.Name)
 				continue
 			}
 
 			needCodegen := false
+			var opts binpackStructOpts
 			for _, comment := range g.Doc.List {
-				needCodegen = needCodegen || strings.HasPrefix(comment.Text, "// cgen: binpack")
+				if !strings.HasPrefix(comment.Text, "// cgen: binpack") {
+					continue
+				}
+
+				needCodegen = true
+				var err error
+				opts, err = parseStructOptions(comment.Text)
+				if err != nil {
+					log.Fatalf("%s: %s: %v", fset.Position(comment.Pos()), currType.Name.Name, err)
+				}
 			}
 			if !needCodegen {
-				fmt.Printf("SKIP struct %#v doesnt have cgen mark\n", currType.Name.Name)
+				logf("SKIP struct %#v doesnt have cgen mark\n", currType.Name.Name)
 				continue SPECS_LOOP
 			}
 
-			fmt.Printf("process struct %s\n", currType.Name.Name)
-			fmt.Printf("\tgenerating Unpack method\n")
+			structs = append(structs, binpackStruct{Name: currType.Name.Name, Node: currStruct, Opts: opts})
+			binpackStructs[currType.Name.Name] = true
+		}
+	}
 
-			fmt.Fprintln(out, "func (in *"+currType.Name.Name+") Unpack(data []byte) error {")
-			fmt.Fprintln(out, "	r := bytes.NewReader(data)")
+	if len(structs) == 0 {
+		logf("no binpack structs in package %s\n", pkgName)
+		return
+	}
 
-		FIELDS_LOOP:
-			for _, field := range currStruct.Fields.List {
+	if err := checkFrameTypes(structs); err != nil {
+		log.Fatalf("package %s: %v", pkgName, err)
+	}
 
-				if field.Tag != nil {
-					tag := reflect.StructTag(field.Tag.Value[1 : len(field.Tag.Value)-1])
-					if tag.Get("cgen") == "-" {
-						continue FIELDS_LOOP
-					}
-				}
+	imports := map[string]bool{"encoding/binary": true, "errors": true, "fmt": true, "io": true, "math": true, "sync": true}
+	body := &bytes.Buffer{}
+	helpersTpl.Execute(body, nil)
 
-				fieldName := field.Names[0].Name
-				fileType := field.Type.(*ast.Ident).Name
+	for _, s := range structs {
+		if s.Opts.Framed {
+			imports["hash/crc32"] = true
+			frameHelpersTpl.Execute(body, *maxFrameLen)
+			break
+		}
+	}
+
+	testBody := &bytes.Buffer{}
 
-				fmt.Printf("\tgenerating code for field %s.%s\n", currType.Name.Name, fieldName)
+	for i, s := range structs {
+		logf("process struct %s\n", s.Name)
+
+		// Pack and Unpack walk the same fields in the same order
+		fields := make([]binpackField, 0)
+
+		for _, field := range s.Node.Fields.List {
+			if len(field.Names) == 0 {
+				log.Fatalf("%s: embedded field %s is unsupported", fset.Position(field.Pos()), types.ExprString(field.Type))
+			}
 
-				switch fileType {
-				case "int":
-					intTpl.Execute(out, tpl{fieldName})
-				case "string":
-					strTpl.Execute(out, tpl{fieldName})
-				default:
-					log.Fatalln("unsupported", fileType)
+			var tag string
+			if field.Tag != nil {
+				tag = reflect.StructTag(field.Tag.Value[1 : len(field.Tag.Value)-1]).Get("cgen")
+			}
+
+			opts, err := parseCgenTag(tag)
+			if err != nil {
+				log.Fatalf("%s: %s: %v", fset.Position(field.Pos()), s.Name, err)
+			}
+			if opts.Skip {
+				continue
+			}
+
+			fieldType, err := resolveType(field.Type, binpackStructs)
+			if err == nil {
+				err = checkOptions(fieldType, opts)
+			}
+			if err != nil {
+				log.Fatalf("%s: %s: %v", fset.Position(field.Pos()), s.Name, err)
+			}
+
+			var defaultValue string
+			if opts.Default != "" {
+				defaultValue, err = defaultLiteral(fieldType, opts.Default)
+				if err != nil {
+					log.Fatalf("%s: %s: %v", fset.Position(field.Pos()), s.Name, err)
 				}
 			}
 
-			fmt.Fprintln(out, "	return nil")
-			fmt.Fprintln(out, "}") // end of Unpack func
-			fmt.Fprintln(out)      // empty line
+			for _, name := range field.Names {
+				fields = append(fields, binpackField{name.Name, fieldType, opts, defaultValue})
+			}
+		}
+
+		if err := checkFieldNumbers(s, fields); err != nil {
+			log.Fatalf("%s: %s: %v", fset.Position(s.Node.Pos()), s.Name, err)
+		}
+		structs[i].Fields = fields
+
+		logf("\tgenerating Unpack method\n")
+		methodsTpl.Execute(body, tpl{StructName: s.Name})
+		if s.Opts.Raw != "" {
+			optionsTpl.Execute(body, optionsTplModel{StructName: s.Name, Options: s.Opts.Raw})
+		}
+		if s.Opts.Framed {
+			logf("\tgenerating frame methods\n")
+			frameMethodsTpl.Execute(body, frameTpl{StructName: s.Name, FrameType: s.Opts.FrameType})
+		}
+
+		if s.Opts.Version != 0 {
+			writeVersionedUnpack(body, s, fields, imports)
+			logf("\tgenerating Pack method\n")
+			writeVersionedPack(body, s, fields, imports)
+			binaryMarshalerTpl.Execute(body, tpl{StructName: s.Name})
+
+			logf("\tgenerating round trip fuzz test\n")
+			fuzzTpl.Execute(testBody, tpl{StructName: s.Name})
+			continue
+		}
+
+		fmt.Fprintf(body, "\nfunc (in *%s) unpack(r *binpackReader) error {\n", s.Name)
+		for _, field := range fields {
+			logf("\tgenerating code for field %s.%s\n", s.Name, field.Name)
+			fmt.Fprintf(body, "\n// %s\n{\n", field.Name)
 
+			e := &fieldEmitter{w: body, structName: s.Name, endian: s.Opts.Endian, field: field, imports: imports}
+			e.unpack(field.Type, "in."+field.Name, field.Name)
+			fmt.Fprintln(body, "}")
 		}
+		fmt.Fprintln(body, "return nil")
+		fmt.Fprintln(body, "}") // end of unpack func
+
+		logf("\tgenerating Pack method\n")
+
+		fmt.Fprintf(body, "\nfunc (in *%s) appendPack(b []byte) ([]byte, error) {\n", s.Name)
+		for _, field := range fields {
+			fmt.Fprintf(body, "\n// %s\n{\n", field.Name)
+
+			e := &fieldEmitter{w: body, structName: s.Name, endian: s.Opts.Endian, field: field, imports: imports}
+			e.pack(field.Type, "in."+field.Name, field.Name)
+			fmt.Fprintln(body, "}")
+		}
+		fmt.Fprintln(body, "return b, nil")
+		fmt.Fprintln(body, "}") // end of pack func
+
+		binaryMarshalerTpl.Execute(body, tpl{StructName: s.Name})
+
+		logf("\tgenerating round trip fuzz test\n")
+		fuzzTpl.Execute(testBody, tpl{StructName: s.Name})
 	}
+
+	header := &bytes.Buffer{}
+	fmt.Fprintln(header, "// Code generated by codegen. DO NOT EDIT.")
+	fmt.Fprintln(header) // empty line
+	fmt.Fprintln(header, `package `+pkgName)
+	fmt.Fprintln(header) // empty line
+	fmt.Fprintln(header, "import (")
+	for _, imp := range sortedKeys(imports) {
+		fmt.Fprintf(header, "\t%q\n", imp)
+	}
+	fmt.Fprintln(header, ")")
+
+	writeSource(outFile, header, body)
+
+	testHeader := &bytes.Buffer{}
+	fuzzHeaderTpl.Execute(testHeader, pkgName)
+	writeSource(strings.TrimSuffix(outFile, ".go")+"_test.go", testHeader, testBody)
+
+	if schemaFile != "" || ksyFile != "" {
+		sch := newSchema(pkgName, structs)
+		if schemaFile != "" {
+			writeSchema(schemaFile, sch)
+		}
+		if ksyFile != "" {
+			writeKsy(ksyFile, sch)
+		}
+	}
+	logf("generated %s\n", outFile)
 }
 
-// go build gen/* && ./codegen.exe pack/unpack.go  pack/marshaller.go
-// go run pack/*
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeSource formats the generated code, so templates don't have to care about indentation
+func writeSource(fileName string, parts ...*bytes.Buffer) {
+	src := &bytes.Buffer{}
+	for _, p := range parts {
+		src.Write(p.Bytes())
+	}
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		log.Fatalf("can't format %s: %v", fileName, err)
+	}
+
+	err = ioutil.WriteFile(fileName, formatted, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
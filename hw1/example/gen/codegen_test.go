@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite layout descriptions in ../pack with the generated ones")
+
+// generateFrom runs the generator for the source and type-checks the source together with the generated code
+func generateFrom(t *testing.T, src string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	inFile := filepath.Join(dir, "in.go")
+	outFile := filepath.Join(dir, "out.go")
+	if err := os.WriteFile(inFile, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	in, err := parser.ParseFile(fset, inFile, nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generate(fset, in.Name.Name, []*ast.File{in}, outFile, "", "")
+
+	out, err := parser.ParseFile(fset, outFile, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check(in.Name.Name, fset, []*ast.File{in, out}, nil); err != nil {
+		generated, _ := os.ReadFile(outFile)
+		t.Fatalf("generated code doesn't compile: %v\n%s", err, generated)
+	}
+
+	return outFile
+}
+
+func TestFieldNamesDontClash(t *testing.T) {
+	// tags can't be written inside a raw string, so ' stands for a backquote
+	generateFrom(t, strings.ReplaceAll(`package names
+
+// the locals of Name are NameLen, NameBytes... and the other fields are named like them
+// cgen: binpack
+type Names struct {
+	Name      string
+	NameLen   uint32
+	NameBytes []byte
+	NameI     []uint16
+	Ptr       *int32
+	PtrValue  int32
+	Ptr2      *Names
+}
+
+// cgen: binpack version=1
+type VersionedNames struct {
+	Name      string 'cgen:"1"'
+	NameStart uint32 'cgen:"2"'
+	NameLen   []byte 'cgen:"3"'
+}
+`, "'", "`"))
+}
+
+// TestLayoutGolden generates the layout descriptions of ../pack and compares them with the committed ones,
+// go test ./gen -update rewrites them
+func TestLayoutGolden(t *testing.T) {
+	dir := t.TempDir()
+	fset := token.NewFileSet()
+	in, err := parser.ParseFile(fset, "../pack/unpack.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generate(fset, in.Name.Name, []*ast.File{in}, filepath.Join(dir, "out.go"),
+		filepath.Join(dir, "layout.json"), filepath.Join(dir, "layout.ksy"))
+
+	for _, name := range []string{"layout.json", "layout.ksy"} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		golden := filepath.Join("../pack", name)
+		if *update {
+			if err := os.WriteFile(golden, got, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s differs from %s, run go test ./gen -update if the change is expected\n%s", name, golden, got)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// fieldEmitter writes Unpack and Pack code for a single field, the caller puts it into its own block
+// (or switch case), so variables of Name don't clash with the ones of NameLen.
+// Nested values of the field get the field name as a prefix of their variables.
+type fieldEmitter struct {
+	w          io.Writer
+	structName string
+	endian     string
+	field      binpackField
+	imports    map[string]bool
+}
+
+func (e *fieldEmitter) printf(format string, args ...interface{}) {
+	fmt.Fprintf(e.w, format, args...)
+}
+
+func (e *fieldEmitter) fail(err string) string {
+	return fmt.Sprintf("return binpackError(%q, %q, %s)", e.structName, e.field.Name, err)
+}
+
+func (e *fieldEmitter) failPack(err string) string {
+	return fmt.Sprintf("return nil, binpackError(%q, %q, %s)", e.structName, e.field.Name, err)
+}
+
+// varintRange returns min and max values for a varint decoded into the type, empty if any value fits
+func varintRange(t *binpackType) (string, string) {
+	if t.Kind == kindInt {
+		if t.isSigned() {
+			return "math.MinInt", "math.MaxInt"
+		}
+		return "", "math.MaxUint"
+	}
+
+	if t.Size == 8 {
+		return "", ""
+	}
+
+	bits := t.Size * 8
+	if t.isSigned() {
+		return fmt.Sprintf("math.MinInt%d", bits), fmt.Sprintf("math.MaxInt%d", bits)
+	}
+	return "", fmt.Sprintf("math.MaxUint%d", bits)
+}
+
+// uintType is the unsigned type of the same width as the fixed-width value
+func uintType(t *binpackType) string {
+	return fmt.Sprintf("uint%d", t.Size*8)
+}
+
+// decodeFixed returns an expression which decodes the fixed-width value from the bytes
+func (e *fieldEmitter) decodeFixed(t *binpackType, bytesVar string) string {
+	switch {
+	case t.GoType == "bool":
+		return bytesVar + "[0] != 0"
+	case t.Size == 1:
+		if t.isByte() {
+			return bytesVar + "[0]"
+		}
+		return fmt.Sprintf("%s(%s[0])", t.GoType, bytesVar)
+	}
+
+	raw := fmt.Sprintf("binary.%s.Uint%d(%s)", e.endian, t.Size*8, bytesVar)
+	switch t.GoType {
+	case uintType(t):
+		return raw
+	case "float32", "float64":
+		e.imports["math"] = true
+		return fmt.Sprintf("math.Float%dfrombits(%s)", t.Size*8, raw)
+	}
+	return fmt.Sprintf("%s(%s)", t.GoType, raw)
+}
+
+// encodeFixed appends the fixed-width value to b
+func (e *fieldEmitter) encodeFixed(t *binpackType, target string) {
+	switch {
+	case t.GoType == "bool":
+		e.printf("if %s {\nb = append(b, 1)\n} else {\nb = append(b, 0)\n}\n", target)
+		return
+	case t.Size == 1:
+		if !t.isByte() {
+			target = "byte(" + target + ")"
+		}
+		e.printf("b = append(b, %s)\n", target)
+		return
+	}
+
+	switch t.GoType {
+	case uintType(t):
+	case "float32", "float64":
+		e.imports["math"] = true
+		target = fmt.Sprintf("math.Float%dbits(%s)", t.Size*8, target)
+	default:
+		target = fmt.Sprintf("%s(%s)", uintType(t), target)
+	}
+	e.printf("b = binary.%s.AppendUint%d(b, %s)\n", e.endian, t.Size*8, target)
+}
+
+func (e *fieldEmitter) unpackVarint(t *binpackType, target, prefix string) {
+	read, rawType := "uvarint", "uint64"
+	if t.isSigned() {
+		read, rawType = "varint", "int64"
+	}
+
+	e.printf("%sRaw, err := r.%s()\n", prefix, read)
+	e.printf("if err != nil {\n%s\n}\n", e.fail("err"))
+
+	min, max := varintRange(t)
+	if max != "" {
+		e.imports["fmt"] = true
+		e.imports["math"] = true
+
+		cond := fmt.Sprintf("%sRaw > %s", prefix, max)
+		if min != "" {
+			cond = fmt.Sprintf("%sRaw < %s || %s", prefix, min, cond)
+		}
+		e.printf("if %s {\n%s\n}\n", cond,
+			e.fail(fmt.Sprintf(`fmt.Errorf("%%d overflows %s", %sRaw)`, t.GoType, prefix)))
+	}
+
+	if rawType == t.GoType {
+		e.printf("%s = %sRaw\n", target, prefix)
+		return
+	}
+	e.printf("%s = %s(%sRaw)\n", target, t.GoType, prefix)
+}
+
+func (e *fieldEmitter) packVarint(t *binpackType, target string) {
+	if t.isSigned() {
+		if t.GoType != "int64" {
+			target = "int64(" + target + ")"
+		}
+		e.printf("b = binary.AppendVarint(b, %s)\n", target)
+		return
+	}
+	if t.GoType != "uint64" {
+		target = "uint64(" + target + ")"
+	}
+	e.printf("b = binary.AppendUvarint(b, %s)\n", target)
+}
+
+// unpackLen declares <prefix>Len and rejects lengths over the limit and lengths the rest of the payload can't hold
+func (e *fieldEmitter) unpackLen(t *binpackType, prefix string) {
+	lenVar := prefix + "Len"
+	switch {
+	case e.field.Opts.Varint:
+		e.printf("%s, err := r.uvarint()\n", lenVar)
+		e.printf("if err != nil {\n%s\n}\n", e.fail("err"))
+	default:
+		lenType := &binpackType{Kind: kindFixed, GoType: fmt.Sprintf("uint%d", e.field.Opts.LenWidth*8), Size: e.field.Opts.LenWidth}
+		e.printf("%sBytes, err := r.next(%d)\n", lenVar, lenType.Size)
+		e.printf("if err != nil {\n%s\n}\n", e.fail("err"))
+		e.printf("%s := %s\n", lenVar, e.decodeFixed(lenType, lenVar+"Bytes"))
+	}
+
+	// no check if the limit is the max value of the prefix
+	if e.field.Opts.Varint || e.field.Opts.MaxLen < int64(1)<<(8*e.field.Opts.LenWidth)-1 {
+		e.imports["fmt"] = true
+		e.printf("if %s > %d {\n%s\n}\n", lenVar, e.field.Opts.MaxLen,
+			e.fail(fmt.Sprintf(`fmt.Errorf("length %%d exceeds limit %d", %s)`, e.field.Opts.MaxLen, lenVar)))
+	}
+
+	elemSize := int64(1)
+	if t.Kind == kindSlice {
+		elemSize = t.Elem.minSize(e.field.Opts.Varint)
+	}
+
+	switch {
+	case elemSize == 1:
+		e.printf("if uint64(%s) > uint64(r.remaining()) {\n%s\n}\n", lenVar, e.fail("io.ErrUnexpectedEOF"))
+	case elemSize > 1:
+		e.printf("if uint64(%s)*%d > uint64(r.remaining()) {\n%s\n}\n", lenVar, elemSize, e.fail("io.ErrUnexpectedEOF"))
+	}
+}
+
+func (e *fieldEmitter) packLen(target string) {
+	e.imports["fmt"] = true
+	e.printf("if len(%s) > %d {\n%s\n}\n", target, e.field.Opts.MaxLen,
+		e.failPack(fmt.Sprintf(`fmt.Errorf("length %%d exceeds limit %d", len(%s))`, e.field.Opts.MaxLen, target)))
+
+	if e.field.Opts.Varint {
+		e.printf("b = binary.AppendUvarint(b, uint64(len(%s)))\n", target)
+		return
+	}
+	lenType := &binpackType{Kind: kindFixed, GoType: fmt.Sprintf("uint%d", e.field.Opts.LenWidth*8), Size: e.field.Opts.LenWidth}
+	e.encodeFixed(lenType, fmt.Sprintf("%s(len(%s))", lenType.GoType, target))
+}
+
+func (e *fieldEmitter) unpack(t *binpackType, target, prefix string) {
+	switch t.Kind {
+	case kindInt:
+		if e.field.Opts.Varint {
+			e.unpackVarint(t, target, prefix)
+			return
+		}
+		e.printf("%sBytes, err := r.next(4)\n", prefix)
+		e.printf("if err != nil {\n%s\n}\n", e.fail("err"))
+		e.printf("%s = %s(binary.%s.Uint32(%sBytes))\n", target, t.GoType, e.endian, prefix)
+
+	case kindFixed:
+		if e.field.Opts.Varint && t.isInteger() {
+			e.unpackVarint(t, target, prefix)
+			return
+		}
+		e.printf("%sBytes, err := r.next(%d)\n", prefix, t.Size)
+		e.printf("if err != nil {\n%s\n}\n", e.fail("err"))
+		if t.GoType == "bool" {
+			// Pack writes only 0 and 1, so other bytes are broken data
+			e.imports["fmt"] = true
+			e.printf("if %sBytes[0] > 1 {\n%s\n}\n", prefix,
+				e.fail(fmt.Sprintf(`fmt.Errorf("invalid bool %%d", %sBytes[0])`, prefix)))
+		}
+		e.printf("%s = %s\n", target, e.decodeFixed(t, prefix+"Bytes"))
+
+	case kindString, kindBytes, kindSlice:
+		e.unpackLen(t, prefix)
+
+		switch t.Kind {
+		case kindString:
+			e.printf("%sBytes, err := r.next(int(%sLen))\n", prefix, prefix)
+			e.printf("if err != nil {\n%s\n}\n", e.fail("err"))
+			e.printf("%s = string(%sBytes)\n", target, prefix)
+		case kindBytes:
+			e.printf("%sBytes, err := r.next(int(%sLen))\n", prefix, prefix)
+			e.printf("if err != nil {\n%s\n}\n", e.fail("err"))
+			e.printf("%s = make(%s, %sLen)\n", target, t.GoType, prefix)
+			e.printf("copy(%s, %sBytes)\n", target, prefix)
+		case kindSlice:
+			// streams can't be checked for the claimed amount of elements, so the slice grows while they are read
+			e.printf("%s = make(%s, 0, r.prealloc(uint64(%sLen)))\n", target, t.GoType, prefix)
+			e.printf("for %sI := 0; %sI < int(%sLen); %sI++ {\n", prefix, prefix, prefix, prefix)
+			e.printf("var %sItem %s\n", prefix, t.Elem.GoType)
+			e.unpack(t.Elem, prefix+"Item", prefix+"Elem")
+			e.printf("%s = append(%s, %sItem)\n", target, target, prefix)
+			e.printf("}\n")
+		}
+
+	case kindArray:
+		if t.Elem.isByte() {
+			e.printf("%sBytes, err := r.next(%d)\n", prefix, t.Len)
+			e.printf("if err != nil {\n%s\n}\n", e.fail("err"))
+			e.printf("copy(%s[:], %sBytes)\n", target, prefix)
+			return
+		}
+		e.printf("for %sI := range %s {\n", prefix, target)
+		e.unpack(t.Elem, fmt.Sprintf("%s[%sI]", target, prefix), prefix+"Elem")
+		e.printf("}\n")
+
+	case kindStruct:
+		e.printf("if err := %s.unpack(r); err != nil {\n%s\n}\n", target, e.fail("err"))
+
+	case kindPointer:
+		e.imports["fmt"] = true
+		e.printf("%sPresent, err := r.next(1)\n", prefix)
+		e.printf("if err != nil {\n%s\n}\n", e.fail("err"))
+		e.printf("switch %sPresent[0] {\ncase 0:\n%s = nil\ncase 1:\n", prefix, target)
+		e.printf("%s = new(%s)\n", target, t.Elem.GoType)
+		e.unpack(t.Elem, "(*"+target+")", prefix+"Value")
+		e.printf("default:\n%s\n}\n", e.fail(fmt.Sprintf(`fmt.Errorf("invalid presence byte %%d", %sPresent[0])`, prefix)))
+	}
+}
+
+func (e *fieldEmitter) pack(t *binpackType, target, prefix string) {
+	switch t.Kind {
+	case kindInt:
+		if e.field.Opts.Varint {
+			e.packVarint(t, target)
+			return
+		}
+		e.imports["fmt"] = true
+		e.imports["math"] = true
+		if t.isSigned() {
+			e.printf("if %s < 0 || uint64(%s) > math.MaxUint32 {\n", target, target)
+		} else {
+			e.printf("if uint64(%s) > math.MaxUint32 {\n", target)
+		}
+		e.printf("%s\n}\n", e.failPack(fmt.Sprintf(`fmt.Errorf("%%d doesn't fit uint32", %s)`, target)))
+		e.printf("b = binary.%s.AppendUint32(b, uint32(%s))\n", e.endian, target)
+
+	case kindFixed:
+		if e.field.Opts.Varint && t.isInteger() {
+			e.packVarint(t, target)
+			return
+		}
+		e.encodeFixed(t, target)
+
+	case kindString, kindBytes, kindSlice:
+		e.packLen(target)
+
+		switch t.Kind {
+		case kindString, kindBytes:
+			e.printf("b = append(b, %s...)\n", target)
+		case kindSlice:
+			e.printf("for %sI := range %s {\n", prefix, target)
+			e.pack(t.Elem, fmt.Sprintf("%s[%sI]", target, prefix), prefix+"Elem")
+			e.printf("}\n")
+		}
+
+	case kindArray:
+		if t.Elem.isByte() {
+			e.printf("b = append(b, %s[:]...)\n", target)
+			return
+		}
+		e.printf("for %sI := range %s {\n", prefix, target)
+		e.pack(t.Elem, fmt.Sprintf("%s[%sI]", target, prefix), prefix+"Elem")
+		e.printf("}\n")
+
+	case kindStruct:
+		e.printf("%sPacked, err := %s.appendPack(b)\n", prefix, target)
+		e.printf("if err != nil {\n%s\n}\n", e.failPack("err"))
+		e.printf("b = %sPacked\n", prefix)
+
+	case kindPointer:
+		e.printf("if %s == nil {\nb = append(b, 0)\n} else {\nb = append(b, 1)\n", target)
+		e.pack(t.Elem, "(*"+target+")", prefix+"Value")
+		e.printf("}\n")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"text/template"
+)
+
+// Frames are written as
+//
+//	magic uint32, frame type uint16, payload length uint32, payload, crc32 uint32
+//
+// all in big-endian, crc32 (IEEE) covers the frame type, the length and the payload.
+var (
+	frameHelpersTpl = template.Must(template.New("frameHelpersTpl").Parse(`
+const binpackFrameMagic = 0x42504b31 // "BPK1"
+
+var (
+	ErrFrameMagic       = errors.New("binpack: bad frame magic")
+	ErrFrameChecksum    = errors.New("binpack: frame checksum mismatch")
+	ErrUnknownFrameType = errors.New("binpack: unknown frame type")
+)
+
+func binpackWriteFrame(w io.Writer, frameType uint16, payload []byte) error {
+	frame := make([]byte, 10, 10+len(payload)+4)
+	binary.BigEndian.PutUint32(frame, binpackFrameMagic)
+	binary.BigEndian.PutUint16(frame[4:], frameType)
+	binary.BigEndian.PutUint32(frame[6:], uint32(len(payload)))
+	frame = append(frame, payload...)
+	frame = binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(frame[4:]))
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// binpackReadFrame reads the whole frame even if its type is unknown, so the stream stays in sync.
+// io.EOF means the stream ended before the frame.
+func binpackReadFrame(r io.Reader) (uint16, []byte, error) {
+	var header [10]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	if binary.BigEndian.Uint32(header[:]) != binpackFrameMagic {
+		return 0, nil, ErrFrameMagic
+	}
+
+	frameType := binary.BigEndian.Uint16(header[4:])
+	size := binary.BigEndian.Uint32(header[6:])
+	if size > {{.}} {
+		return 0, nil, fmt.Errorf("binpack: frame length %d exceeds limit {{.}}", size)
+	}
+
+	rest := make([]byte, int(size)+4)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+
+	payload := rest[:size]
+	checksum := crc32.Update(crc32.ChecksumIEEE(header[4:]), crc32.IEEETable, payload)
+	if binary.BigEndian.Uint32(rest[size:]) != checksum {
+		return 0, nil, ErrFrameChecksum
+	}
+	return frameType, payload, nil
+}
+
+// FrameDemux reads frames and passes the unpacked structs to the handlers registered for their types
+type FrameDemux struct {
+	handlers map[uint16]func(payload []byte) error
+}
+
+func (d *FrameDemux) handle(frameType uint16, fn func(payload []byte) error) {
+	if d.handlers == nil {
+		d.handlers = make(map[uint16]func(payload []byte) error)
+	}
+	d.handlers[frameType] = fn
+}
+
+// Next reads a single frame and calls its handler. Frames without a handler give ErrUnknownFrameType,
+// the stream can still be read after it.
+func (d *FrameDemux) Next(r io.Reader) error {
+	frameType, payload, err := binpackReadFrame(r)
+	if err != nil {
+		return err
+	}
+
+	fn, ok := d.handlers[frameType]
+	if !ok {
+		return fmt.Errorf("%w %d", ErrUnknownFrameType, frameType)
+	}
+	return fn(payload)
+}
+`))
+
+	frameMethodsTpl = template.Must(template.New("frameMethodsTpl").Parse(`
+const {{.StructName}}FrameType = {{.FrameType}}
+
+// WriteFrame writes packed {{.StructName}} as a single frame
+func (in *{{.StructName}}) WriteFrame(w io.Writer) error {
+	payload, err := in.Pack()
+	if err != nil {
+		return err
+	}
+	return binpackWriteFrame(w, {{.StructName}}FrameType, payload)
+}
+
+// ReadFrame reads a single frame, it must be a {{.StructName}} frame
+func (in *{{.StructName}}) ReadFrame(r io.Reader) error {
+	frameType, payload, err := binpackReadFrame(r)
+	if err != nil {
+		return err
+	}
+	if frameType != {{.StructName}}FrameType {
+		return fmt.Errorf("{{.StructName}}: %w %d", ErrUnknownFrameType, frameType)
+	}
+	return in.Unpack(payload)
+}
+
+// Handle{{.StructName}} registers the handler for {{.StructName}} frames
+func (d *FrameDemux) Handle{{.StructName}}(fn func(in *{{.StructName}}) error) {
+	d.handle({{.StructName}}FrameType, func(payload []byte) error {
+		in := &{{.StructName}}{}
+		if err := in.Unpack(payload); err != nil {
+			return err
+		}
+		return fn(in)
+	})
+}
+`))
+)
+
+type frameTpl struct {
+	StructName string
+	FrameType  int64
+}
+
+// checkFrameTypes makes sure every frame type is used only once in the package
+func checkFrameTypes(structs []binpackStruct) error {
+	types := make(map[int64]string)
+	for _, s := range structs {
+		if !s.Opts.Framed {
+			continue
+		}
+		if other, ok := types[s.Opts.FrameType]; ok {
+			return fmt.Errorf("structs %s and %s have the same frame type %d", other, s.Name, s.Opts.FrameType)
+		}
+		types[s.Opts.FrameType] = s.Name
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"unicode"
+)
+
+// ksyAttr is a single seq entry of a Kaitai Struct type, keys keep their order
+type ksyAttr [][2]string
+
+type ksyType struct {
+	Name   string
+	Endian string
+	Seq    []ksyAttr
+	Raw    string // hand-written body for helper types
+}
+
+// ksyWriter turns the schema into a Kaitai Struct description, one type per struct
+type ksyWriter struct {
+	types  []*ksyType
+	endian string // of the struct being written
+	varint bool
+}
+
+var ksyFixedTypes = map[string]string{
+	"bool":    "u1",
+	"uint8":   "u1",
+	"int8":    "s1",
+	"uint16":  "u2",
+	"int16":   "s2",
+	"uint32":  "u4",
+	"int32":   "s4",
+	"uint64":  "u8",
+	"int64":   "s8",
+	"float32": "f4",
+	"float64": "f8",
+}
+
+// ksyZigzag decodes signed varints, the common vlq type only has the unsigned value
+const ksyZigzag = `    seq:
+      - id: raw
+        type: vlq_base128_le
+    instances:
+      value:
+        value: '(raw.value >> 1) ^ -(raw.value & 1)'
+`
+
+// snakeCase converts Go names to Kaitai ids, e.g. UserID to user_id
+func snakeCase(name string) string {
+	runes := []rune(name)
+	res := make([]rune, 0, len(runes)+4)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 &&
+			(unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			res = append(res, '_')
+		}
+		res = append(res, unicode.ToLower(r))
+	}
+	return string(res)
+}
+
+func (k *ksyWriter) addType(t *ksyType) string {
+	t.Endian = k.endian
+	k.types = append(k.types, t)
+	return t.Name
+}
+
+// typeOf returns the Kaitai type of a single value, complex values get a helper type with the given name
+func (k *ksyWriter) typeOf(v *schemaValue, helperName string) string {
+	switch v.Encoding {
+	case "uvarint":
+		k.varint = true
+		return "vlq_base128_le"
+	case "varint":
+		k.varint = true
+		return "zigzag_varint"
+	case "struct":
+		return snakeCase(v.Struct)
+	}
+	if t, ok := ksyFixedTypes[v.Encoding]; ok {
+		return t
+	}
+	return k.addType(&ksyType{Name: helperName, Seq: k.attrs("value", v, helperName)})
+}
+
+// attrs returns seq entries of the value, prefix is used for names of helper types
+func (k *ksyWriter) attrs(id string, v *schemaValue, prefix string) []ksyAttr {
+	switch v.Encoding {
+	case "string", "bytes", "slice":
+		lenAttr := ksyAttr{{"id", id + "_len"}}
+		lenExpr := id + "_len"
+		if v.LenPrefix == "uvarint" {
+			k.varint = true
+			lenAttr = append(lenAttr, [2]string{"type", "vlq_base128_le"})
+			lenExpr += ".value"
+		} else {
+			lenAttr = append(lenAttr, [2]string{"type", ksyFixedTypes[v.LenPrefix]})
+		}
+
+		attr := ksyAttr{{"id", id}}
+		switch v.Encoding {
+		case "string":
+			attr = append(attr, [2]string{"type", "str"}, [2]string{"size", lenExpr}, [2]string{"encoding", "UTF-8"})
+		case "bytes":
+			attr = append(attr, [2]string{"size", lenExpr})
+		case "slice":
+			attr = append(attr, [2]string{"type", k.typeOf(v.Elem, prefix+"_"+id+"_elem")},
+				[2]string{"repeat", "expr"}, [2]string{"repeat-expr", lenExpr})
+		}
+		return []ksyAttr{lenAttr, attr}
+
+	case "array":
+		if v.Elem.Encoding == "uint8" {
+			return []ksyAttr{{{"id", id}, {"size", fmt.Sprint(v.Len)}}}
+		}
+		return []ksyAttr{{{"id", id}, {"type", k.typeOf(v.Elem, prefix+"_"+id+"_elem")},
+			{"repeat", "expr"}, {"repeat-expr", fmt.Sprint(v.Len)}}}
+
+	case "optional":
+		return []ksyAttr{
+			{{"id", id + "_present"}, {"type", "u1"}},
+			{{"id", id}, {"type", k.typeOf(v.Elem, prefix+"_"+id+"_value")}, {"if", id + "_present == 1"}},
+		}
+	}
+
+	return []ksyAttr{{{"id", id}, {"type", k.typeOf(v, prefix+"_"+id)}}}
+}
+
+func (k *ksyWriter) addStruct(s *schemaStruct) {
+	k.endian = "le"
+	if s.Endian == "big" {
+		k.endian = "be"
+	}
+	name := snakeCase(s.Name)
+
+	if s.Layout == "sequential" {
+		t := &ksyType{Name: name}
+		k.addType(t)
+		for i := range s.Fields {
+			t.Seq = append(t.Seq, k.attrs(snakeCase(s.Fields[i].Name), &s.Fields[i].schemaValue, name)...)
+		}
+		return
+	}
+
+	// versioned structs are a list of number, length, value records, unknown numbers are left as raw bytes
+	k.varint = true
+	k.addType(&ksyType{Name: name, Seq: []ksyAttr{
+		{{"id", "version"}, {"type", "vlq_base128_le"}},
+		{{"id", "body_len"}, {"type", "vlq_base128_le"}},
+		{{"id", "body"}, {"type", name + "_fields"}, {"size", "body_len.value"}},
+	}})
+	k.addType(&ksyType{Name: name + "_fields", Seq: []ksyAttr{
+		{{"id", "fields"}, {"type", name + "_field"}, {"repeat", "eos"}},
+	}})
+
+	cases := &bytes.Buffer{}
+	for i := range s.Fields {
+		f := &s.Fields[i]
+		t := &ksyType{Name: name + "_" + snakeCase(f.Name)}
+		k.addType(t)
+		t.Seq = k.attrs(snakeCase(f.Name), &f.schemaValue, t.Name)
+		fmt.Fprintf(cases, "            %d: %s\n", f.Num, t.Name)
+	}
+
+	k.addType(&ksyType{Name: name + "_field", Raw: `    seq:
+      - id: num
+        type: vlq_base128_le
+      - id: len
+        type: vlq_base128_le
+      - id: value
+        size: len.value
+        type:
+          switch-on: num.value
+          cases:
+` + cases.String()})
+}
+
+func writeKsy(fileName string, sch schema) {
+	k := &ksyWriter{}
+	for i := range sch.Structs {
+		k.addStruct(&sch.Structs[i])
+	}
+	if k.varint {
+		k.endian = "le"
+		k.addType(&ksyType{Name: "zigzag_varint", Raw: ksyZigzag})
+	}
+
+	out := &bytes.Buffer{}
+	fmt.Fprintln(out, "# Code generated by codegen. DO NOT EDIT.")
+	fmt.Fprintln(out, "meta:")
+	fmt.Fprintf(out, "  id: %s\n", snakeCase(sch.Package))
+	fmt.Fprintln(out, "  endian: le")
+	if k.varint {
+		fmt.Fprintln(out, "  imports:")
+		fmt.Fprintln(out, "    - /common/vlq_base128_le")
+	}
+	fmt.Fprintln(out, "doc: binpack structs, each of them is a separate type")
+	fmt.Fprintln(out, "types:")
+
+	for _, t := range k.types {
+		fmt.Fprintf(out, "  %s:\n", t.Name)
+		fmt.Fprintf(out, "    meta:\n      endian: %s\n", t.Endian)
+		if t.Raw != "" {
+			out.WriteString(t.Raw)
+			continue
+		}
+		if len(t.Seq) == 0 {
+			continue
+		}
+
+		fmt.Fprintln(out, "    seq:")
+		for _, attr := range t.Seq {
+			for i, kv := range attr {
+				indent := "        "
+				if i == 0 {
+					indent = "      - "
+				}
+				fmt.Fprintf(out, "%s%s: %s\n", indent, kv[0], ksyScalar(kv[1]))
+			}
+		}
+	}
+
+	err := ioutil.WriteFile(fileName, out.Bytes(), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ksyScalar quotes values which YAML would read as something else
+func ksyScalar(s string) string {
+	if strings.ContainsAny(s, ":#=") {
+		return "'" + s + "'"
+	}
+	return s
+}
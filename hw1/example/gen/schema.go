@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+// schema describes the wire layout of binpack structs for decoders in other languages
+type schema struct {
+	Package string         `json:"package"`
+	Structs []schemaStruct `json:"structs"`
+}
+
+type schemaStruct struct {
+	Name    string        `json:"name"`
+	Endian  string        `json:"endian"`            // little or big, for all fixed-width values of the struct
+	Layout  string        `json:"layout"`            // sequential or versioned
+	Version int64         `json:"version,omitempty"` // for versioned structs
+	Size    int64         `json:"size,omitempty"`    // if all fields are fixed-width
+	Frame   *int64        `json:"frame,omitempty"`   // frame type if the struct is sent in frames
+	Fields  []schemaField `json:"fields"`
+}
+
+type schemaField struct {
+	Name    string `json:"name"`
+	Num     int64  `json:"num,omitempty"`     // field number in versioned structs
+	Offset  *int64 `json:"offset,omitempty"`  // if all previous fields of a sequential struct are fixed-width
+	Default string `json:"default,omitempty"` // value of a missing field in versioned structs
+	schemaValue
+}
+
+// schemaValue describes a single value, encodings are:
+// uintN, intN, floatN, bool - fixed width, bool is a byte with 0 or 1;
+// uvarint, varint - LEB128, varint is zigzag encoded;
+// string, bytes, slice - length prefix, then bytes or elements;
+// array - fixed amount of elements; struct - nested struct; optional - presence byte, then the value if it's 1
+type schemaValue struct {
+	GoType    string       `json:"go_type"`
+	Encoding  string       `json:"encoding"`
+	Size      int64        `json:"size,omitempty"`       // width of fixed-width values
+	LenPrefix string       `json:"len_prefix,omitempty"` // uint8, uint16, uint32 or uvarint
+	MaxLen    int64        `json:"max_len,omitempty"`
+	Len       int64        `json:"len,omitempty"` // for arrays
+	Struct    string       `json:"struct,omitempty"`
+	Elem      *schemaValue `json:"elem,omitempty"`
+}
+
+func endianName(endian string) string {
+	return strings.ToLower(strings.TrimSuffix(endian, "Endian"))
+}
+
+func newSchemaValue(t *binpackType, opts cgenTag) schemaValue {
+	v := schemaValue{GoType: t.GoType, Encoding: t.Kind}
+
+	switch t.Kind {
+	case kindInt:
+		v.Encoding, v.Size = "uint32", 4
+	case kindFixed:
+		v.Encoding, v.Size = t.GoType, t.Size
+		switch t.GoType {
+		case "byte":
+			v.Encoding = "uint8"
+		case "rune":
+			v.Encoding = "int32"
+		}
+	case kindString, kindBytes, kindSlice:
+		v.LenPrefix = fmt.Sprintf("uint%d", opts.LenWidth*8)
+		if opts.Varint {
+			v.LenPrefix = "uvarint"
+		}
+		v.MaxLen = opts.MaxLen
+	case kindArray:
+		v.Len = t.Len
+	case kindStruct:
+		v.Struct = t.GoType
+	case kindPointer:
+		v.Encoding = "optional"
+	}
+
+	if opts.Varint && t.isInteger() {
+		v.Encoding, v.Size = "uvarint", 0
+		if t.isSigned() {
+			v.Encoding = "varint"
+		}
+	}
+
+	if t.Elem != nil && t.Kind != kindBytes {
+		elemOpts := opts
+		if t.Kind == kindArray && t.Elem.isByte() {
+			// byte arrays are copied as is, varint doesn't apply to them
+			elemOpts.Varint = false
+		}
+		elem := newSchemaValue(t.Elem, elemOpts)
+		v.Elem = &elem
+	}
+	return v
+}
+
+// fixedSize returns the width of the value if it doesn't depend on the data
+func (v *schemaValue) fixedSize(structs map[string]*schemaStruct) (int64, bool) {
+	switch {
+	case v.Size != 0:
+		return v.Size, true
+	case v.Encoding == "array":
+		size, ok := v.Elem.fixedSize(structs)
+		return size * v.Len, ok
+	case v.Encoding == "struct":
+		s := structs[v.Struct]
+		return s.Size, s.Size != 0 || len(s.Fields) == 0 && s.Layout == "sequential"
+	}
+	return 0, false
+}
+
+// fillOffsets sets offsets of sequential struct fields while they are known
+func (s *schemaStruct) fillOffsets(structs map[string]*schemaStruct) {
+	if s.Layout != "sequential" {
+		return
+	}
+
+	offset := int64(0)
+	for i := range s.Fields {
+		fieldOffset := offset
+		s.Fields[i].Offset = &fieldOffset
+
+		size, ok := s.Fields[i].fixedSize(structs)
+		if !ok {
+			return
+		}
+		offset += size
+	}
+	s.Size = offset
+}
+
+func newSchema(pkg string, structs []binpackStruct) schema {
+	res := schema{Package: pkg, Structs: make([]schemaStruct, 0, len(structs))}
+
+	for _, s := range structs {
+		ss := schemaStruct{Name: s.Name, Endian: endianName(s.Opts.Endian), Layout: "sequential", Version: s.Opts.Version}
+		if s.Opts.Version != 0 {
+			ss.Layout = "versioned"
+		}
+		if s.Opts.Framed {
+			frameType := s.Opts.FrameType
+			ss.Frame = &frameType
+		}
+
+		for _, f := range s.Fields {
+			ss.Fields = append(ss.Fields, schemaField{
+				Name:        f.Name,
+				Num:         f.Opts.Num,
+				Default:     f.Opts.Default,
+				schemaValue: newSchemaValue(f.Type, f.Opts),
+			})
+		}
+		res.Structs = append(res.Structs, ss)
+	}
+
+	// nested structs are usually declared after the structs they are used in
+	byName := make(map[string]*schemaStruct)
+	for i := range res.Structs {
+		byName[res.Structs[i].Name] = &res.Structs[i]
+	}
+	for i := range res.Structs {
+		resolveSize(&res.Structs[i], byName, make(map[string]bool))
+	}
+
+	return res
+}
+
+// resolveSize fills offsets of nested structs before the struct itself
+func resolveSize(s *schemaStruct, structs map[string]*schemaStruct, visiting map[string]bool) {
+	if visiting[s.Name] {
+		return
+	}
+	visiting[s.Name] = true
+
+	for _, f := range s.Fields {
+		for v := &f.schemaValue; v != nil; v = v.Elem {
+			if v.Encoding == "struct" {
+				resolveSize(structs[v.Struct], structs, visiting)
+			}
+		}
+	}
+	s.fillOffsets(structs)
+}
+
+func writeSchema(fileName string, sch schema) {
+	data, err := json.MarshalIndent(sch, "", "  ")
+	if err != nil {
+		log.Fatalf("can't encode schema: %v", err)
+	}
+
+	err = ioutil.WriteFile(fileName, append(data, '\n'), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// wire kinds of binpack fields
+const (
+	kindInt     = "int"     // int and uint, uint32 on the wire
+	kindFixed   = "fixed"   // int8..int64, uint8..uint64, float32, float64, bool
+	kindString  = "string"  // uint32 length + bytes
+	kindBytes   = "bytes"   // []byte, uint32 length + bytes
+	kindSlice   = "slice"   // uint32 length + elements
+	kindArray   = "array"   // fixed amount of elements, no length
+	kindStruct  = "struct"  // nested binpack struct
+	kindPointer = "pointer" // presence byte, then the value if it's 1
+)
+
+var fixedSizes = map[string]int64{
+	"bool":    1,
+	"int8":    1,
+	"uint8":   1,
+	"byte":    1,
+	"int16":   2,
+	"uint16":  2,
+	"int32":   4,
+	"uint32":  4,
+	"rune":    4,
+	"float32": 4,
+	"int64":   8,
+	"uint64":  8,
+	"float64": 8,
+}
+
+// binpackType describes how a value is laid out on the wire
+type binpackType struct {
+	Kind   string
+	GoType string
+	Size   int64 // for fixed-width values
+	Len    int64 // for arrays
+	Elem   *binpackType
+}
+
+type binpackField struct {
+	Name    string
+	Type    *binpackType
+	Opts    cgenTag
+	Default string // Go literal for fields missing in versioned payloads, zero value if empty
+}
+
+func (t *binpackType) isInteger() bool {
+	return t.Kind == kindInt || (t.Kind == kindFixed && t.GoType != "bool" && !strings.HasPrefix(t.GoType, "float"))
+}
+
+func (t *binpackType) isSigned() bool {
+	return t.GoType == "rune" || strings.HasPrefix(t.GoType, "int")
+}
+
+// hasLen is true for values with a length prefix
+func (t *binpackType) hasLen() bool {
+	return t.Kind == kindString || t.Kind == kindBytes || t.Kind == kindSlice
+}
+
+// walk calls fn for the type and all types nested in it, nested structs have their own options
+func (t *binpackType) walk(fn func(t *binpackType)) {
+	fn(t)
+	if t.Elem != nil && t.Kind != kindStruct {
+		t.Elem.walk(fn)
+	}
+}
+
+// resolveType maps a field type to its wire layout, structs are supported if they are marked with cgen too
+func resolveType(expr ast.Expr, binpackStructs map[string]bool) (*binpackType, error) {
+	goType := types.ExprString(expr)
+
+	switch t := expr.(type) {
+	case *ast.Ident:
+		switch {
+		case t.Name == "int" || t.Name == "uint":
+			return &binpackType{Kind: kindInt, GoType: goType}, nil
+		case t.Name == "string":
+			return &binpackType{Kind: kindString, GoType: goType}, nil
+		case fixedSizes[t.Name] != 0:
+			return &binpackType{Kind: kindFixed, GoType: goType, Size: fixedSizes[t.Name]}, nil
+		case binpackStructs[t.Name]:
+			return &binpackType{Kind: kindStruct, GoType: goType}, nil
+		}
+
+	case *ast.ArrayType:
+		elem, err := resolveType(t.Elt, binpackStructs)
+		if err != nil {
+			return nil, err
+		}
+
+		if t.Len == nil {
+			if elem.isByte() {
+				return &binpackType{Kind: kindBytes, GoType: goType, Elem: elem}, nil
+			}
+			return &binpackType{Kind: kindSlice, GoType: goType, Elem: elem}, nil
+		}
+
+		lit, ok := t.Len.(*ast.BasicLit)
+		if !ok {
+			return nil, fmt.Errorf("array length must be a literal in %s", goType)
+		}
+		n, err := strconv.ParseInt(lit.Value, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid array length in %s", goType)
+		}
+		return &binpackType{Kind: kindArray, GoType: goType, Len: n, Elem: elem}, nil
+
+	case *ast.StarExpr:
+		elem, err := resolveType(t.X, binpackStructs)
+		if err != nil {
+			return nil, err
+		}
+		return &binpackType{Kind: kindPointer, GoType: goType, Elem: elem}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", goType)
+}
+
+func (t *binpackType) isByte() bool {
+	return t.Kind == kindFixed && (t.GoType == "byte" || t.GoType == "uint8")
+}
+
+// minSize is the least amount of bytes the value takes, it's used to reject lengths bigger than the payload
+func (t *binpackType) minSize(varint bool) int64 {
+	switch t.Kind {
+	case kindFixed:
+		if varint && t.isInteger() {
+			return 1
+		}
+		return t.Size
+	case kindInt:
+		if varint {
+			return 1
+		}
+		return 4
+	case kindString, kindBytes, kindSlice:
+		// short lengths can take a single byte
+		return 1
+	case kindArray:
+		return t.Len * t.Elem.minSize(varint)
+	case kindPointer:
+		return 1
+	}
+
+	// nested structs are counted as a byte even if they are empty, so a slice of them
+	// can't have more elements than bytes left and a short payload can't make a huge slice
+	return 1
+}
+
+// cgenTag is a parsed `cgen:"..."` field tag, e.g. `cgen:"-"` or `cgen:"varint,max=64"`.
+// Options apply to the value and to all values nested in it.
+// Fields of versioned structs start with the field number: `cgen:"2,default=en"`.
+type cgenTag struct {
+	Skip     bool
+	MaxLen   int64
+	Varint   bool   // integers are varints, lengths are uvarints
+	LenWidth int64  // width of length prefixes in bytes: 1, 2 or 4
+	Num      int64  // field number in versioned structs
+	Default  string // raw default value, can't contain commas
+}
+
+var lenWidths = map[string]int64{
+	"u8len":  1,
+	"u16len": 2,
+	"u32len": 4,
+}
+
+func parseCgenTag(tag string) (cgenTag, error) {
+	res := cgenTag{MaxLen: *maxLen, LenWidth: 4}
+	if tag == "-" {
+		res.Skip = true
+		return res, nil
+	}
+
+	for i, opt := range strings.Split(tag, ",") {
+		switch {
+		case opt == "":
+			continue
+		case i == 0 && opt[0] >= '0' && opt[0] <= '9':
+			n, err := strconv.ParseInt(opt, 10, 64)
+			if err != nil || n < 1 || n > math.MaxUint32 {
+				return res, fmt.Errorf("invalid field number in %q", tag)
+			}
+			res.Num = n
+		case strings.HasPrefix(opt, "default="):
+			res.Default = strings.TrimPrefix(opt, "default=")
+		case opt == "varint":
+			res.Varint = true
+		case lenWidths[opt] != 0:
+			res.LenWidth = lenWidths[opt]
+		case strings.HasPrefix(opt, "max="):
+			n, err := strconv.ParseInt(strings.TrimPrefix(opt, "max="), 10, 64)
+			if err != nil || n < 0 || n > math.MaxUint32 {
+				return res, fmt.Errorf("invalid max length in %q", tag)
+			}
+			res.MaxLen = n
+		default:
+			return res, fmt.Errorf("unknown option %q", opt)
+		}
+	}
+
+	// lengths must fit the prefix
+	if !res.Varint && res.LenWidth < 4 {
+		widthMax := int64(1)<<(8*res.LenWidth) - 1
+		if res.MaxLen > widthMax {
+			res.MaxLen = widthMax
+		}
+	}
+
+	return res, nil
+}
+
+// checkOptions makes sure the field options make sense for its type
+func checkOptions(t *binpackType, opts cgenTag) error {
+	var err error
+	hasInts, hasLens := false, false
+	t.walk(func(t *binpackType) {
+		hasInts = hasInts || t.isInteger()
+		hasLens = hasLens || t.hasLen()
+	})
+
+	if opts.Varint && !hasInts && !hasLens {
+		err = fmt.Errorf("varint is only for integers and length prefixes, got %s", t.GoType)
+	}
+	if opts.LenWidth != 4 && !hasLens {
+		err = fmt.Errorf("length width is only for strings and slices, got %s", t.GoType)
+	}
+
+	return err
+}
+
+// defaultLiteral checks the default value of the field and returns it as Go literal
+func defaultLiteral(t *binpackType, raw string) (string, error) {
+	invalid := fmt.Errorf("invalid default %q for %s", raw, t.GoType)
+
+	switch {
+	case t.Kind == kindString:
+		return strconv.Quote(raw), nil
+	case t.GoType == "bool":
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return "", invalid
+		}
+		return strconv.FormatBool(v), nil
+	case t.isInteger() && t.isSigned():
+		v, err := strconv.ParseInt(raw, 10, intBits(t))
+		if err != nil {
+			return "", invalid
+		}
+		return strconv.FormatInt(v, 10), nil
+	case t.isInteger():
+		v, err := strconv.ParseUint(raw, 10, intBits(t))
+		if err != nil {
+			return "", invalid
+		}
+		return strconv.FormatUint(v, 10), nil
+	case t.Kind == kindFixed:
+		v, err := strconv.ParseFloat(raw, int(t.Size*8))
+		if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+			return "", invalid
+		}
+		return strconv.FormatFloat(v, 'g', -1, int(t.Size*8)), nil
+	}
+
+	return "", fmt.Errorf("default is only for numbers, bools and strings, got %s", t.GoType)
+}
+
+// intBits is the width of the Go integer type, int and uint are 32-bit on the wire
+func intBits(t *binpackType) int {
+	if t.Kind == kindInt {
+		return 32
+	}
+	return int(t.Size * 8)
+}
+
+// binpackStructOpts is parsed from the struct comment, e.g. `// cgen: binpack endian=big`
+type binpackStructOpts struct {
+	Endian    string // name of the encoding/binary byte order
+	Version   int64  // versioned structs have a header and numbered fields
+	Framed    bool   // WriteFrame and ReadFrame are generated
+	FrameType int64
+	Raw       string // options as they are written in the comment
+}
+
+func parseStructOptions(comment string) (binpackStructOpts, error) {
+	res := binpackStructOpts{Endian: "LittleEndian"}
+	res.Raw = strings.Join(strings.Fields(strings.TrimPrefix(comment, "// cgen: binpack")), " ")
+
+	for _, opt := range strings.Fields(res.Raw) {
+		switch {
+		case opt == "endian=little":
+			res.Endian = "LittleEndian"
+		case opt == "endian=big":
+			res.Endian = "BigEndian"
+		case strings.HasPrefix(opt, "version="):
+			n, err := strconv.ParseInt(strings.TrimPrefix(opt, "version="), 10, 64)
+			if err != nil || n < 1 {
+				return res, fmt.Errorf("invalid version in %q", opt)
+			}
+			res.Version = n
+		case strings.HasPrefix(opt, "frame="):
+			n, err := strconv.ParseInt(strings.TrimPrefix(opt, "frame="), 10, 64)
+			if err != nil || n < 0 || n > math.MaxUint16 {
+				return res, fmt.Errorf("invalid frame type in %q", opt)
+			}
+			res.Framed, res.FrameType = true, n
+		default:
+			return res, fmt.Errorf("unknown option %q", opt)
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Versioned structs are packed as
+//
+//	version uvarint, body length uvarint, body
+//
+// and the body is a list of fields, each of them is
+//
+//	field number uvarint, value length uvarint, value
+//
+// Unpack skips unknown field numbers and leaves missing fields with zero or default values,
+// so binaries built with older and newer versions of the struct can read each other's data.
+
+// checkFieldNumbers makes sure fields are numbered if and only if the struct is versioned
+func checkFieldNumbers(s binpackStruct, fields []binpackField) error {
+	nums := make(map[int64]string)
+	for _, f := range fields {
+		switch {
+		case s.Opts.Version == 0 && f.Opts.Num != 0:
+			return fmt.Errorf("field %s has a number, but the struct has no version=N", f.Name)
+		case s.Opts.Version == 0 && f.Opts.Default != "":
+			return fmt.Errorf("field %s has a default, but the struct has no version=N", f.Name)
+		case s.Opts.Version != 0 && f.Opts.Num == 0:
+			return fmt.Errorf("field %s of versioned struct needs a number, e.g. `cgen:\"1\"`", f.Name)
+		case nums[f.Opts.Num] != "":
+			return fmt.Errorf("fields %s and %s have the same number %d", nums[f.Opts.Num], f.Name, f.Opts.Num)
+		}
+		if f.Opts.Num != 0 {
+			nums[f.Opts.Num] = f.Name
+		}
+	}
+	return nil
+}
+
+// zeroValue returns the literal of the field's zero value
+func zeroValue(t *binpackType) string {
+	switch t.Kind {
+	case kindString:
+		return `""`
+	case kindBytes, kindSlice, kindPointer:
+		return "nil"
+	case kindArray, kindStruct:
+		return t.GoType + "{}"
+	}
+	if t.GoType == "bool" {
+		return "false"
+	}
+	return "0"
+}
+
+func writeVersionedUnpack(w io.Writer, s binpackStruct, fields []binpackField, imports map[string]bool) {
+	imports["fmt"] = true
+	fail := func(what, err string) string {
+		return fmt.Sprintf("return binpackError(%q, %q, %s)", s.Name, what, err)
+	}
+
+	fmt.Fprintf(w, "\nfunc (in *%s) unpack(r *binpackReader) error {\n", s.Name)
+	fmt.Fprintln(w, "// any version is accepted, unknown fields are skipped")
+	fmt.Fprintf(w, "if _, err := r.uvarint(); err != nil {\n%s\n}\n", fail("version", "err"))
+
+	fmt.Fprintf(w, "versionedLen, err := r.uvarint()\nif err != nil {\n%s\n}\n", fail("length", "err"))
+	fmt.Fprintf(w, "if versionedLen > %d {\n%s\n}\n", *maxLen,
+		fail("length", fmt.Sprintf(`fmt.Errorf("length %%d exceeds limit %d", versionedLen)`, *maxLen)))
+	fmt.Fprintf(w, "if versionedLen > uint64(r.remaining()) {\n%s\n}\n", fail("length", "io.ErrUnexpectedEOF"))
+	fmt.Fprintf(w, "versionedBody, err := r.next(int(versionedLen))\nif err != nil {\n%s\n}\n", fail("length", "err"))
+	fmt.Fprintln(w, "versionedFields := &binpackReader{data: versionedBody}")
+
+	fmt.Fprintln(w, "\n// fields missing in the payload keep these values")
+	for _, f := range fields {
+		value := f.Default
+		if value == "" {
+			value = zeroValue(f.Type)
+		}
+		fmt.Fprintf(w, "in.%s = %s\n", f.Name, value)
+	}
+
+	fmt.Fprintln(w, "\nfor versionedFields.remaining() > 0 {")
+	fmt.Fprintf(w, "fieldNum, err := versionedFields.uvarint()\nif err != nil {\n%s\n}\n", fail("field number", "err"))
+	fmt.Fprintf(w, "fieldLen, err := versionedFields.uvarint()\nif err != nil {\n%s\n}\n", fail("field length", "err"))
+	fmt.Fprintf(w, "if fieldLen > uint64(versionedFields.remaining()) {\n%s\n}\n", fail("field length", "io.ErrUnexpectedEOF"))
+	if len(fields) == 0 {
+		fmt.Fprintln(w, "versionedFields.next(int(fieldLen))")
+		fmt.Fprintln(w, "}") // end of fields loop
+		fmt.Fprintln(w, "return nil")
+		fmt.Fprintln(w, "}") // end of unpack func
+		return
+	}
+	fmt.Fprintln(w, "fieldValue, _ := versionedFields.next(int(fieldLen))")
+
+	fmt.Fprintln(w, "\nswitch fieldNum {")
+	for _, f := range fields {
+		logf("\tgenerating code for field %s.%s\n", s.Name, f.Name)
+		fmt.Fprintf(w, "case %d: // %s\n", f.Opts.Num, f.Name)
+		fmt.Fprintln(w, "r := &binpackReader{data: fieldValue}")
+
+		e := &fieldEmitter{w: w, structName: s.Name, endian: s.Opts.Endian, field: f, imports: imports}
+		e.unpack(f.Type, "in."+f.Name, f.Name)
+	}
+	fmt.Fprintln(w, "}") // end of switch
+	fmt.Fprintln(w, "}") // end of fields loop
+
+	fmt.Fprintln(w, "return nil")
+	fmt.Fprintln(w, "}") // end of unpack func
+}
+
+func writeVersionedPack(w io.Writer, s binpackStruct, fields []binpackField, imports map[string]bool) {
+	imports["fmt"] = true
+
+	fmt.Fprintf(w, "\nfunc (in *%s) appendPack(b []byte) ([]byte, error) {\n", s.Name)
+	fmt.Fprintf(w, "b = binary.AppendUvarint(b, %d) // version\n", s.Opts.Version)
+	fmt.Fprintln(w, "versionedStart := len(b)")
+
+	for _, f := range fields {
+		fmt.Fprintf(w, "\n// %s\n{\n", f.Name)
+		fmt.Fprintf(w, "b = binary.AppendUvarint(b, %d)\n", f.Opts.Num)
+		fmt.Fprintf(w, "%sStart := len(b)\n", f.Name)
+
+		e := &fieldEmitter{w: w, structName: s.Name, endian: s.Opts.Endian, field: f, imports: imports}
+		e.pack(f.Type, "in."+f.Name, f.Name)
+		fmt.Fprintf(w, "b = binpackInsertLen(b, %sStart)\n", f.Name)
+		fmt.Fprintln(w, "}")
+	}
+
+	fmt.Fprintf(w, "\nif len(b)-versionedStart > %d {\n", *maxLen)
+	fmt.Fprintf(w, "return nil, binpackError(%q, \"length\", fmt.Errorf(\"length %%d exceeds limit %d\", len(b)-versionedStart))\n}\n", s.Name, *maxLen)
+	fmt.Fprintln(w, "b = binpackInsertLen(b, versionedStart)")
+
+	fmt.Fprintln(w, "return b, nil")
+	fmt.Fprintln(w, "}") // end of pack func
+}
@@ -0,0 +1,442 @@
+package pack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+func appendStruct(b []byte, v reflect.Value) ([]byte, error) {
+	c, err := codecFor(v.Type())
+	if err != nil {
+		return nil, err
+	}
+	if c.version != 0 {
+		return c.appendVersioned(b, v)
+	}
+
+	for _, f := range c.fields {
+		b, err = c.appendValue(b, v.Field(f.index), f.opts)
+		if err != nil {
+			return nil, fieldError(c.name, f.name, err)
+		}
+	}
+	return b, nil
+}
+
+// appendVersioned writes the version, the body length and the fields as number, length, value
+func (c *structCodec) appendVersioned(b []byte, v reflect.Value) ([]byte, error) {
+	var err error
+	b = binary.AppendUvarint(b, uint64(c.version))
+	start := len(b)
+
+	for _, f := range c.fields {
+		b = binary.AppendUvarint(b, uint64(f.opts.num))
+		fieldStart := len(b)
+		b, err = c.appendValue(b, v.Field(f.index), f.opts)
+		if err != nil {
+			return nil, fieldError(c.name, f.name, err)
+		}
+		b = insertLen(b, fieldStart)
+	}
+
+	if len(b)-start > DefaultMaxLen {
+		return nil, fieldError(c.name, "length", fmt.Errorf("length %d exceeds limit %d", len(b)-start, DefaultMaxLen))
+	}
+	return insertLen(b, start), nil
+}
+
+// insertLen inserts the uvarint length of b[start:] before it
+func insertLen(b []byte, start int) []byte {
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(b)-start))
+	b = append(b, prefix[:n]...)
+	copy(b[start+n:], b[start:len(b)-n])
+	copy(b[start:], prefix[:n])
+	return b
+}
+
+func (c *structCodec) appendFixed(b []byte, v reflect.Value) []byte {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 1)
+		}
+		return append(b, 0)
+	case reflect.Float32:
+		return c.order.AppendUint32(b, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		return c.order.AppendUint64(b, math.Float64bits(v.Float()))
+	}
+
+	var x uint64
+	if isSigned(v.Type()) {
+		x = uint64(v.Int())
+	} else {
+		x = v.Uint()
+	}
+
+	switch v.Type().Size() {
+	case 1:
+		return append(b, byte(x))
+	case 2:
+		return c.order.AppendUint16(b, uint16(x))
+	case 4:
+		return c.order.AppendUint32(b, uint32(x))
+	}
+	return c.order.AppendUint64(b, x)
+}
+
+func (c *structCodec) appendLen(b []byte, n int, opts tagOptions) ([]byte, error) {
+	if uint64(n) > opts.maxLen {
+		return nil, fmt.Errorf("length %d exceeds limit %d", n, opts.maxLen)
+	}
+
+	switch {
+	case opts.varint:
+		return binary.AppendUvarint(b, uint64(n)), nil
+	case opts.lenWidth == 1:
+		return append(b, byte(n)), nil
+	case opts.lenWidth == 2:
+		return c.order.AppendUint16(b, uint16(n)), nil
+	}
+	return c.order.AppendUint32(b, uint32(n)), nil
+}
+
+func (c *structCodec) appendValue(b []byte, v reflect.Value, opts tagOptions) ([]byte, error) {
+	t := v.Type()
+	switch {
+	case opts.varint && isInteger(t):
+		if isSigned(t) {
+			return binary.AppendVarint(b, v.Int()), nil
+		}
+		return binary.AppendUvarint(b, v.Uint()), nil
+
+	case isInt(t):
+		if isSigned(t) && (v.Int() < 0 || v.Int() > math.MaxUint32) {
+			return nil, fmt.Errorf("%d doesn't fit uint32", v.Int())
+		}
+		if !isSigned(t) && v.Uint() > math.MaxUint32 {
+			return nil, fmt.Errorf("%d doesn't fit uint32", v.Uint())
+		}
+		if isSigned(t) {
+			return c.order.AppendUint32(b, uint32(v.Int())), nil
+		}
+		return c.order.AppendUint32(b, uint32(v.Uint())), nil
+
+	case isFixed(t):
+		return c.appendFixed(b, v), nil
+	}
+
+	var err error
+	switch t.Kind() {
+	case reflect.String:
+		if b, err = c.appendLen(b, v.Len(), opts); err != nil {
+			return nil, err
+		}
+		return append(b, v.String()...), nil
+
+	case reflect.Slice:
+		if b, err = c.appendLen(b, v.Len(), opts); err != nil {
+			return nil, err
+		}
+		if isByte(t.Elem()) {
+			return append(b, v.Bytes()...), nil
+		}
+		return c.appendElems(b, v, opts)
+
+	case reflect.Array:
+		if isByte(t.Elem()) {
+			// byte arrays are copied as is even with varint, the same as in generated code
+			for i := 0; i < v.Len(); i++ {
+				b = append(b, byte(v.Index(i).Uint()))
+			}
+			return b, nil
+		}
+		return c.appendElems(b, v, opts)
+
+	case reflect.Struct:
+		return appendStruct(b, v)
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return append(b, 0), nil
+		}
+		return c.appendValue(append(b, 1), v.Elem(), opts)
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+func (c *structCodec) appendElems(b []byte, v reflect.Value, opts tagOptions) ([]byte, error) {
+	var err error
+	for i := 0; i < v.Len(); i++ {
+		b, err = c.appendValue(b, v.Index(i), opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func decodeStruct(d *decoder, v reflect.Value) error {
+	c, err := codecFor(v.Type())
+	if err != nil {
+		return err
+	}
+	if c.version != 0 {
+		return c.decodeVersioned(d, v)
+	}
+
+	for _, f := range c.fields {
+		if err := c.decodeValue(d, v.Field(f.index), f.opts); err != nil {
+			return fieldError(c.name, f.name, err)
+		}
+	}
+	return nil
+}
+
+// decodeVersioned skips unknown fields and leaves missing ones with zero or default values
+func (c *structCodec) decodeVersioned(d *decoder, v reflect.Value) error {
+	if _, err := d.uvarint(); err != nil {
+		return fieldError(c.name, "version", err)
+	}
+	bodyLen, err := d.uvarint()
+	if err != nil {
+		return fieldError(c.name, "length", err)
+	}
+	if bodyLen > DefaultMaxLen {
+		return fieldError(c.name, "length", fmt.Errorf("length %d exceeds limit %d", bodyLen, DefaultMaxLen))
+	}
+	if bodyLen > uint64(len(d.data)) {
+		return fieldError(c.name, "length", io.ErrUnexpectedEOF)
+	}
+	body, _ := d.next(int(bodyLen))
+	fields := &decoder{data: body}
+
+	for _, f := range c.fields {
+		v.Field(f.index).Set(f.def)
+	}
+
+	for len(fields.data) > 0 {
+		num, err := fields.uvarint()
+		if err != nil {
+			return fieldError(c.name, "field number", err)
+		}
+		size, err := fields.uvarint()
+		if err != nil {
+			return fieldError(c.name, "field length", err)
+		}
+		if size > uint64(len(fields.data)) {
+			return fieldError(c.name, "field length", io.ErrUnexpectedEOF)
+		}
+		value, _ := fields.next(int(size))
+
+		// unknown fields are skipped
+		f, ok := c.byNum[int64(num)]
+		if !ok {
+			continue
+		}
+		if err := c.decodeValue(&decoder{data: value}, v.Field(f.index), f.opts); err != nil {
+			return fieldError(c.name, f.name, err)
+		}
+	}
+	return nil
+}
+
+func (c *structCodec) decodeFixed(b []byte, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		if b[0] > 1 {
+			return fmt.Errorf("invalid bool %d", b[0])
+		}
+		v.SetBool(b[0] == 1)
+		return nil
+	case reflect.Float32:
+		v.SetFloat(float64(math.Float32frombits(c.order.Uint32(b))))
+		return nil
+	case reflect.Float64:
+		v.SetFloat(math.Float64frombits(c.order.Uint64(b)))
+		return nil
+	}
+
+	var x uint64
+	switch len(b) {
+	case 1:
+		x = uint64(b[0])
+	case 2:
+		x = uint64(c.order.Uint16(b))
+	case 4:
+		x = uint64(c.order.Uint32(b))
+	default:
+		x = c.order.Uint64(b)
+	}
+
+	// sign extension of narrow types
+	if isSigned(v.Type()) {
+		shift := 64 - 8*uint(len(b))
+		v.SetInt(int64(x<<shift) >> shift)
+		return nil
+	}
+	v.SetUint(x)
+	return nil
+}
+
+// decodeLen reads the length prefix and rejects lengths over the limit and lengths the rest of the payload can't hold
+func (c *structCodec) decodeLen(d *decoder, t reflect.Type, opts tagOptions) (int, error) {
+	var n uint64
+	if opts.varint {
+		var err error
+		if n, err = d.uvarint(); err != nil {
+			return 0, err
+		}
+	} else {
+		b, err := d.next(opts.lenWidth)
+		if err != nil {
+			return 0, err
+		}
+		switch opts.lenWidth {
+		case 1:
+			n = uint64(b[0])
+		case 2:
+			n = uint64(c.order.Uint16(b))
+		default:
+			n = uint64(c.order.Uint32(b))
+		}
+	}
+
+	if n > opts.maxLen {
+		return 0, fmt.Errorf("length %d exceeds limit %d", n, opts.maxLen)
+	}
+
+	elemSize := uint64(1)
+	if t.Kind() == reflect.Slice && !isByte(t.Elem()) {
+		elemSize = minSize(t.Elem(), opts.varint)
+	}
+	if n*elemSize > uint64(len(d.data)) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return int(n), nil
+}
+
+func (c *structCodec) decodeValue(d *decoder, v reflect.Value, opts tagOptions) error {
+	t := v.Type()
+	switch {
+	case opts.varint && isInteger(t):
+		if isSigned(t) {
+			x, err := d.varint()
+			if err != nil {
+				return err
+			}
+			if v.OverflowInt(x) {
+				return fmt.Errorf("%d overflows %s", x, t)
+			}
+			v.SetInt(x)
+			return nil
+		}
+		x, err := d.uvarint()
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(x) {
+			return fmt.Errorf("%d overflows %s", x, t)
+		}
+		v.SetUint(x)
+		return nil
+
+	case isInt(t):
+		b, err := d.next(4)
+		if err != nil {
+			return err
+		}
+		x := c.order.Uint32(b)
+		if isSigned(t) {
+			v.SetInt(int64(x))
+		} else {
+			v.SetUint(uint64(x))
+		}
+		return nil
+
+	case isFixed(t):
+		b, err := d.next(int(t.Size()))
+		if err != nil {
+			return err
+		}
+		return c.decodeFixed(b, v)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		n, err := c.decodeLen(d, t, opts)
+		if err != nil {
+			return err
+		}
+		b, err := d.next(n)
+		if err != nil {
+			return err
+		}
+		v.SetString(string(b))
+		return nil
+
+	case reflect.Slice:
+		n, err := c.decodeLen(d, t, opts)
+		if err != nil {
+			return err
+		}
+		if isByte(t.Elem()) {
+			b, err := d.next(n)
+			if err != nil {
+				return err
+			}
+			// reflect.Copy needs the same element types, Bytes works for named byte types too
+			s := reflect.MakeSlice(t, n, n)
+			copy(s.Bytes(), b)
+			v.Set(s)
+			return nil
+		}
+		v.Set(reflect.MakeSlice(t, n, n))
+		return c.decodeElems(d, v, opts)
+
+	case reflect.Array:
+		if isByte(t.Elem()) {
+			b, err := d.next(v.Len())
+			if err != nil {
+				return err
+			}
+			copy(v.Bytes(), b)
+			return nil
+		}
+		return c.decodeElems(d, v, opts)
+
+	case reflect.Struct:
+		return decodeStruct(d, v)
+
+	case reflect.Ptr:
+		present, err := d.next(1)
+		if err != nil {
+			return err
+		}
+		switch present[0] {
+		case 0:
+			v.Set(reflect.Zero(t))
+			return nil
+		case 1:
+			v.Set(reflect.New(t.Elem()))
+			return c.decodeValue(d, v.Elem(), opts)
+		}
+		return fmt.Errorf("invalid presence byte %d", present[0])
+	}
+
+	return fmt.Errorf("unsupported type %s", t)
+}
+
+func (c *structCodec) decodeElems(d *decoder, v reflect.Value, opts tagOptions) error {
+	for i := 0; i < v.Len(); i++ {
+		if err := c.decodeValue(d, v.Index(i), opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+// Package pack packs structs with reflection into the same bytes as the code generated for `// cgen: binpack`.
+// It's slower than the generated code, but works for types which can't go through codegen.
+//
+// Field tags are the same as for the generator. Options of the cgen comment (endian, version)
+// are read from the BinpackOptions method if the struct has it, the generator adds it too.
+package pack
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxLen limits lengths of strings and slices without `cgen:"max=N"`, it's the default -maxlen of the generator
+const DefaultMaxLen = 1 << 20
+
+var errVarintOverflow = errors.New("varint overflows a 64-bit integer")
+
+// Optioner is implemented by structs with options in the cgen comment, e.g. "endian=big version=2"
+type Optioner interface {
+	BinpackOptions() string
+}
+
+// Marshal packs v, a struct or a pointer to it
+func Marshal(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("pack: can't marshal %T, it's not a struct", v)
+	}
+	return appendStruct(nil, rv)
+}
+
+// Unmarshal unpacks data into v, a non-nil pointer to a struct. Bytes after the struct are ignored.
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("pack: can't unmarshal into %T, it's not a pointer to a struct", v)
+	}
+	return decodeStruct(&decoder{data: data}, rv.Elem())
+}
+
+// byteOrder is implemented by binary.LittleEndian and binary.BigEndian
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+type structCodec struct {
+	name    string
+	order   byteOrder
+	version int64
+	fields  []field
+	byNum   map[int64]*field
+}
+
+type field struct {
+	name  string
+	index int
+	typ   reflect.Type
+	opts  tagOptions
+	def   reflect.Value // value of missing fields in versioned structs
+}
+
+// tagOptions is a parsed `cgen:"..."` tag
+type tagOptions struct {
+	skip     bool
+	maxLen   uint64
+	varint   bool
+	lenWidth int
+	num      int64
+	def      string
+}
+
+var codecs sync.Map // reflect.Type to *structCodec
+
+// codecFor parses the struct once, nested structs are parsed when they are reached,
+// so recursive types like linked lists are fine
+func codecFor(t reflect.Type) (*structCodec, error) {
+	if c, ok := codecs.Load(t); ok {
+		return c.(*structCodec), nil
+	}
+
+	c := &structCodec{name: t.Name(), order: binary.LittleEndian, byNum: make(map[int64]*field)}
+	if o, ok := reflect.New(t).Interface().(Optioner); ok {
+		if err := c.parseOptions(o.BinpackOptions()); err != nil {
+			return nil, fmt.Errorf("pack: %s: %v", c.name, err)
+		}
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		opts, err := parseTag(sf.Tag.Get("cgen"))
+		if err != nil {
+			return nil, fmt.Errorf("pack: %s.%s: %v", c.name, sf.Name, err)
+		}
+		if opts.skip {
+			continue
+		}
+
+		f := field{name: sf.Name, index: i, typ: sf.Type, opts: opts, def: reflect.Zero(sf.Type)}
+		err = c.checkField(sf, &f)
+		if err != nil {
+			return nil, fmt.Errorf("pack: %s.%s: %v", c.name, sf.Name, err)
+		}
+		c.fields = append(c.fields, f)
+	}
+
+	for i := range c.fields {
+		if c.fields[i].opts.num != 0 {
+			c.byNum[c.fields[i].opts.num] = &c.fields[i]
+		}
+	}
+
+	actual, _ := codecs.LoadOrStore(t, c)
+	return actual.(*structCodec), nil
+}
+
+func (c *structCodec) parseOptions(options string) error {
+	for _, opt := range strings.Fields(options) {
+		switch {
+		case opt == "endian=little":
+			c.order = binary.LittleEndian
+		case opt == "endian=big":
+			c.order = binary.BigEndian
+		case strings.HasPrefix(opt, "version="):
+			n, err := strconv.ParseInt(strings.TrimPrefix(opt, "version="), 10, 64)
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid version in %q", opt)
+			}
+			c.version = n
+		case strings.HasPrefix(opt, "frame="):
+			// frames are up to the generated code
+		default:
+			return fmt.Errorf("unknown option %q", opt)
+		}
+	}
+	return nil
+}
+
+func (c *structCodec) checkField(sf reflect.StructField, f *field) error {
+	if sf.PkgPath != "" {
+		return errors.New("unexported fields can't be set, skip them with `cgen:\"-\"`")
+	}
+	if sf.Anonymous {
+		return errors.New("embedded fields are unsupported")
+	}
+	if err := checkType(f.typ, f.opts); err != nil {
+		return err
+	}
+
+	switch {
+	case c.version == 0 && f.opts.num != 0:
+		return errors.New("field has a number, but the struct has no version=N")
+	case c.version == 0 && f.opts.def != "":
+		return errors.New("field has a default, but the struct has no version=N")
+	case c.version != 0 && f.opts.num == 0:
+		return errors.New("field of versioned struct needs a number")
+	case c.byNum[f.opts.num] != nil:
+		return fmt.Errorf("number %d is used twice", f.opts.num)
+	}
+	if f.opts.num != 0 {
+		c.byNum[f.opts.num] = f
+	}
+
+	if f.opts.def != "" {
+		def, err := parseDefault(f.typ, f.opts.def)
+		if err != nil {
+			return err
+		}
+		f.def = def
+	}
+	return nil
+}
+
+// decoder reads from the payload, running out of it is io.ErrUnexpectedEOF
+type decoder struct {
+	data []byte
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if len(d.data) < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b, nil
+}
+
+func (d *decoder) uvarint() (uint64, error) {
+	var x uint64
+	var s uint
+	for i := 0; i < binary.MaxVarintLen64; i++ {
+		b, err := d.next(1)
+		if err != nil {
+			return 0, err
+		}
+		if b[0] < 0x80 {
+			if i == binary.MaxVarintLen64-1 && b[0] > 1 {
+				return 0, errVarintOverflow
+			}
+			return x | uint64(b[0])<<s, nil
+		}
+		x |= uint64(b[0]&0x7f) << s
+		s += 7
+	}
+	return 0, errVarintOverflow
+}
+
+func (d *decoder) varint() (int64, error) {
+	ux, err := d.uvarint()
+	x := int64(ux >> 1)
+	if ux&1 != 0 {
+		x = ^x
+	}
+	return x, err
+}
+
+// fieldError keeps the struct and field names the same way the generated code does
+func fieldError(structName, fieldName string, err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("%s.%s: %w", structName, fieldName, err)
+}
@@ -0,0 +1,187 @@
+package pack
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var lenWidths = map[string]int{
+	"u8len":  1,
+	"u16len": 2,
+	"u32len": 4,
+}
+
+func parseTag(tag string) (tagOptions, error) {
+	res := tagOptions{maxLen: DefaultMaxLen, lenWidth: 4}
+	if tag == "-" {
+		res.skip = true
+		return res, nil
+	}
+
+	for i, opt := range strings.Split(tag, ",") {
+		switch {
+		case opt == "":
+			continue
+		case i == 0 && opt[0] >= '0' && opt[0] <= '9':
+			n, err := strconv.ParseInt(opt, 10, 64)
+			if err != nil || n < 1 || n > math.MaxUint32 {
+				return res, fmt.Errorf("invalid field number in %q", tag)
+			}
+			res.num = n
+		case strings.HasPrefix(opt, "default="):
+			res.def = strings.TrimPrefix(opt, "default=")
+		case opt == "varint":
+			res.varint = true
+		case lenWidths[opt] != 0:
+			res.lenWidth = lenWidths[opt]
+		case strings.HasPrefix(opt, "max="):
+			n, err := strconv.ParseUint(strings.TrimPrefix(opt, "max="), 10, 32)
+			if err != nil {
+				return res, fmt.Errorf("invalid max length in %q", tag)
+			}
+			res.maxLen = n
+		default:
+			return res, fmt.Errorf("unknown option %q", opt)
+		}
+	}
+
+	// lengths must fit the prefix
+	if !res.varint && res.lenWidth < 4 {
+		widthMax := uint64(1)<<(8*res.lenWidth) - 1
+		if res.maxLen > widthMax {
+			res.maxLen = widthMax
+		}
+	}
+
+	return res, nil
+}
+
+// isInt is true for int and uint, they are uint32 on the wire
+func isInt(t reflect.Type) bool {
+	return t.Kind() == reflect.Int || t.Kind() == reflect.Uint
+}
+
+// isFixed is true for fixed-width numbers and bools
+func isFixed(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func isInteger(t reflect.Type) bool {
+	return isInt(t) || isFixed(t) && t.Kind() != reflect.Bool && t.Kind() != reflect.Float32 && t.Kind() != reflect.Float64
+}
+
+func isSigned(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isByte(t reflect.Type) bool {
+	return t.Kind() == reflect.Uint8
+}
+
+// hasLen is true for values with a length prefix
+func hasLen(t reflect.Type) bool {
+	return t.Kind() == reflect.String || t.Kind() == reflect.Slice
+}
+
+// checkType makes sure the type can be packed and the options make sense for it
+func checkType(t reflect.Type, opts tagOptions) error {
+	hasInts, hasLens := false, false
+	for elem := t; ; elem = elem.Elem() {
+		hasInts = hasInts || isInteger(elem)
+		hasLens = hasLens || hasLen(elem)
+
+		switch {
+		case isInt(elem) || isFixed(elem) || elem.Kind() == reflect.String || elem.Kind() == reflect.Struct:
+		case elem.Kind() == reflect.Slice || elem.Kind() == reflect.Array || elem.Kind() == reflect.Ptr:
+			continue
+		default:
+			return fmt.Errorf("unsupported type %s", t)
+		}
+		break
+	}
+
+	if opts.varint && !hasInts && !hasLens {
+		return fmt.Errorf("varint is only for integers and length prefixes, got %s", t)
+	}
+	if opts.lenWidth != 4 && !hasLens {
+		return fmt.Errorf("length width is only for strings and slices, got %s", t)
+	}
+	return nil
+}
+
+// minSize is the least amount of bytes the value takes, it's used to reject lengths bigger than the payload
+func minSize(t reflect.Type, varint bool) uint64 {
+	switch {
+	case isInt(t):
+		if varint {
+			return 1
+		}
+		return 4
+	case isFixed(t):
+		if varint && isInteger(t) {
+			return 1
+		}
+		return uint64(t.Size())
+	case hasLen(t), t.Kind() == reflect.Ptr:
+		return 1
+	case t.Kind() == reflect.Array:
+		return uint64(t.Len()) * minSize(t.Elem(), varint)
+	}
+
+	// nested structs are counted as a byte even if they are empty, the same as in generated code
+	return 1
+}
+
+// parseDefault converts the default of the field, int and uint are 32-bit on the wire
+func parseDefault(t reflect.Type, raw string) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	bits := 32
+	if isFixed(t) && t.Kind() != reflect.Bool {
+		bits = t.Bits()
+	}
+
+	var err error
+	switch {
+	case t.Kind() == reflect.String:
+		v.SetString(raw)
+	case t.Kind() == reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(raw)
+		v.SetBool(b)
+	case isInteger(t) && isSigned(t):
+		var n int64
+		n, err = strconv.ParseInt(raw, 10, bits)
+		v.SetInt(n)
+	case isInteger(t):
+		var n uint64
+		n, err = strconv.ParseUint(raw, 10, bits)
+		v.SetUint(n)
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(raw, bits)
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			err = errors.New("not a finite number")
+		}
+		v.SetFloat(f)
+	default:
+		return v, fmt.Errorf("default is only for numbers, bools and strings, got %s", t)
+	}
+
+	if err != nil {
+		return v, fmt.Errorf("invalid default %q for %s", raw, t)
+	}
+	return v, nil
+}
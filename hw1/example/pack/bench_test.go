@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+var benchUser = User{ID: 1123456, Login: "v.romanov", Flags: 16}
+
+var benchSession = Session{
+	UserID:  7,
+	Active:  true,
+	Score:   4.5,
+	Payload: []byte("some payload"),
+	Roles:   []string{"admin", "user"},
+	Ports:   []uint16{80, 443, 8080},
+	Owner:   benchUser,
+}
+
+// unpackUserReflect decodes User the way the generator used to, with reflection-based binary.Read
+func unpackUserReflect(in *User, data []byte) error {
+	r := bytes.NewReader(data)
+
+	var id, loginLen, flags uint32
+	if err := binary.Read(r, binary.LittleEndian, &id); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &loginLen); err != nil {
+		return err
+	}
+	login := make([]byte, loginLen)
+	if _, err := io.ReadFull(r, login); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &flags); err != nil {
+		return err
+	}
+
+	in.ID, in.Login, in.Flags = int(id), string(login), int(flags)
+	return nil
+}
+
+func packUserReflect(in *User) []byte {
+	w := &bytes.Buffer{}
+	binary.Write(w, binary.LittleEndian, uint32(in.ID))
+	binary.Write(w, binary.LittleEndian, uint32(len(in.Login)))
+	w.WriteString(in.Login)
+	binary.Write(w, binary.LittleEndian, uint32(in.Flags))
+	return w.Bytes()
+}
+
+func TestUserReflectCompatible(t *testing.T) {
+	packed, err := benchUser.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packed, packUserReflect(&benchUser)) {
+		t.Fatalf("Pack and binary.Write differ:\n%v\n%v", packed, packUserReflect(&benchUser))
+	}
+
+	u := User{}
+	if err := unpackUserReflect(&u, packed); err != nil || u != benchUser {
+		t.Fatalf("binary.Read gave %+v, %v", u, err)
+	}
+}
+
+func TestUnpackFromStream(t *testing.T) {
+	var stream []byte
+	for i := 0; i < 3; i++ {
+		u := benchUser
+		u.ID = i
+		stream = u.AppendPack(stream)
+	}
+
+	r := bytes.NewReader(stream)
+	for i := 0; i < 3; i++ {
+		u := User{}
+		if err := u.UnpackFrom(r); err != nil {
+			t.Fatalf("user %d: %v", i, err)
+		}
+		if u.ID != i || u.Login != benchUser.Login {
+			t.Fatalf("user %d: got %+v", i, u)
+		}
+	}
+
+	if err := (&User{}).UnpackFrom(r); err != io.EOF {
+		t.Fatalf("expected io.EOF at the end of the stream, got %v", err)
+	}
+	if err := (&User{}).UnpackFrom(bytes.NewReader(stream[:6])); err == nil || err == io.EOF {
+		t.Fatalf("expected an error for a truncated user, got %v", err)
+	}
+}
+
+func BenchmarkUserUnpack(b *testing.B) {
+	data, _ := benchUser.Pack()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		u := User{}
+		if err := u.Unpack(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// unpackUserFrom returns a func which unpacks the user from the stream again and again
+func unpackUserFrom(tb testing.TB, user User) func() {
+	data, _ := user.Pack()
+	r := bytes.NewReader(data)
+	return func() {
+		r.Reset(data)
+		u := User{}
+		if err := u.UnpackFrom(r); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func TestUnpackFromAllocs(t *testing.T) {
+	// the reader itself allocates nothing, a user without strings is read without allocations
+	if allocs := testing.AllocsPerRun(100, unpackUserFrom(t, User{ID: 1, Flags: 16})); allocs != 0 {
+		t.Fatalf("UnpackFrom made %v allocations, want 0", allocs)
+	}
+}
+
+func BenchmarkUserUnpackFrom(b *testing.B) {
+	unpack := unpackUserFrom(b, benchUser)
+	// the only allocation is the Login string, the same as in Unpack
+	if allocs := testing.AllocsPerRun(100, unpack); allocs != 1 {
+		b.Fatalf("UnpackFrom made %v allocations, want 1", allocs)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		unpack()
+	}
+}
+
+func BenchmarkUserUnpackReflect(b *testing.B) {
+	data, _ := benchUser.Pack()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		u := User{}
+		if err := unpackUserReflect(&u, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUserAppendPack(b *testing.B) {
+	buf := make([]byte, 0, 64)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = benchUser.AppendPack(buf[:0])
+	}
+}
+
+func BenchmarkUserPackReflect(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		packUserReflect(&benchUser)
+	}
+}
+
+func BenchmarkSessionUnpack(b *testing.B) {
+	data, _ := benchSession.Pack()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s := Session{}
+		if err := s.Unpack(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSessionAppendPack(b *testing.B) {
+	buf := make([]byte, 0, 256)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = benchSession.AppendPack(buf[:0])
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestFrameDemux(t *testing.T) {
+	stream := &bytes.Buffer{}
+	if err := benchUser.WriteFrame(stream); err != nil {
+		t.Fatal(err)
+	}
+	if err := benchSession.WriteFrame(stream); err != nil {
+		t.Fatal(err)
+	}
+	if err := benchUser.WriteFrame(stream); err != nil {
+		t.Fatal(err)
+	}
+
+	users, sessions := 0, 0
+	demux := &FrameDemux{}
+	demux.HandleUser(func(u *User) error {
+		if *u != benchUser {
+			t.Errorf("got user %+v", u)
+		}
+		users++
+		return nil
+	})
+
+	// sessions have no handler yet, but the stream stays readable after them
+	for i := 0; i < 2; i++ {
+		err := demux.Next(stream)
+		if i == 1 && !errors.Is(err, ErrUnknownFrameType) {
+			t.Fatalf("expected ErrUnknownFrameType for the session, got %v", err)
+		}
+		if i == 0 && err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	demux.HandleSession(func(s *Session) error {
+		if s.Owner != benchUser || len(s.Roles) != 2 {
+			t.Errorf("got session %+v", s)
+		}
+		sessions++
+		return nil
+	})
+	if err := demux.Next(stream); err != nil {
+		t.Fatal(err)
+	}
+	if err := demux.Next(stream); err != io.EOF {
+		t.Fatalf("expected io.EOF at the end of the stream, got %v", err)
+	}
+	if users != 2 || sessions != 0 {
+		t.Fatalf("got %d users and %d sessions", users, sessions)
+	}
+}
+
+func TestFrameErrors(t *testing.T) {
+	frame := &bytes.Buffer{}
+	if err := benchUser.WriteFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+	data := frame.Bytes()
+
+	corrupted := append([]byte(nil), data...)
+	corrupted[12]++
+	if err := (&User{}).ReadFrame(bytes.NewReader(corrupted)); err != ErrFrameChecksum {
+		t.Fatalf("expected ErrFrameChecksum, got %v", err)
+	}
+
+	corrupted = append([]byte(nil), data...)
+	corrupted[0] = 0
+	if err := (&User{}).ReadFrame(bytes.NewReader(corrupted)); err != ErrFrameMagic {
+		t.Fatalf("expected ErrFrameMagic, got %v", err)
+	}
+
+	if err := (&User{}).ReadFrame(bytes.NewReader(data[:len(data)-1])); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF for a truncated frame, got %v", err)
+	}
+
+	if err := (&Session{}).ReadFrame(bytes.NewReader(data)); !errors.Is(err, ErrUnknownFrameType) {
+		t.Fatalf("expected ErrUnknownFrameType for a user frame, got %v", err)
+	}
+}
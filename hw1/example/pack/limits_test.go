@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/AlexeyKremsa/coursera-homework/hw1/example/lib/pack"
+)
+
+// allocated returns the amount of bytes fn allocates
+func allocated(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestSliceOfStructsLimit(t *testing.T) {
+	// an empty name and a million members in 8 bytes
+	data := binary.LittleEndian.AppendUint32(nil, 0)
+	data = binary.LittleEndian.AppendUint32(data, 1<<20)
+
+	var err error
+	size := allocated(func() {
+		err = (&Team{}).Unpack(data)
+	})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if size > 64<<10 {
+		t.Fatalf("Unpack allocated %d bytes for an 8-byte payload", size)
+	}
+
+	// a stream can't tell how much is left, the slice grows while members are read
+	size = allocated(func() {
+		err = (&Team{}).UnpackFrom(bytes.NewReader(data))
+	})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if size > 256<<10 {
+		t.Fatalf("UnpackFrom allocated %d bytes for an 8-byte stream", size)
+	}
+
+	size = allocated(func() {
+		err = pack.Unmarshal(data, &Team{})
+	})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if size > 64<<10 {
+		t.Fatalf("Unmarshal allocated %d bytes for an 8-byte payload", size)
+	}
+}
@@ -1,26 +1,1405 @@
+// Code generated by codegen. DO NOT EDIT.
+
 package main
 
-import "encoding/binary"
-import "bytes"
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"sync"
+)
+
+func binpackError(structName, fieldName string, err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("%s.%s: %w", structName, fieldName, err)
+}
+
+var errBinpackVarintOverflow = errors.New("varint overflows a 64-bit integer")
+
+// binpackReader decodes from a byte slice or, if src is set, from a stream
+type binpackReader struct {
+	data []byte
+	src  io.Reader
+	buf  []byte // reused for stream reads
+	read int
+}
+
+// binpackScratch keeps buffers for stream reads, the buffer is passed to io.Reader,
+// so it can't stay on the stack and would be allocated by every UnpackFrom
+var binpackScratch = sync.Pool{
+	New: func() interface{} {
+		return new([64]byte)
+	},
+}
+
+// binpackStreamPrealloc limits slices made before their elements are read from a stream,
+// the stream may end long before the length it claims
+const binpackStreamPrealloc = 1024
+
+// next returns n bytes, in stream mode they are valid only until the next call
+func (r *binpackReader) next(n int) ([]byte, error) {
+	if r.src == nil {
+		if len(r.data) < n {
+			return nil, io.ErrUnexpectedEOF
+		}
+		b := r.data[:n]
+		r.data = r.data[n:]
+		return b, nil
+	}
+
+	if cap(r.buf) < n {
+		size := 64
+		for size < n {
+			size *= 2
+		}
+		r.buf = make([]byte, size)
+	}
+	b := r.buf[:n]
+	read, err := io.ReadFull(r.src, b)
+	r.read += read
+	return b, err
+}
+
+// remaining is the amount of bytes left, streams don't know it
+func (r *binpackReader) remaining() int {
+	if r.src == nil {
+		return len(r.data)
+	}
+	return math.MaxInt
+}
+
+// prealloc is the capacity of a slice of n elements, byte slices are already checked to hold them,
+// slices read from streams grow as their elements are read
+func (r *binpackReader) prealloc(n uint64) int {
+	if r.src != nil && n > binpackStreamPrealloc {
+		return binpackStreamPrealloc
+	}
+	return int(n)
+}
+
+func (r *binpackReader) uvarint() (uint64, error) {
+	var x uint64
+	var s uint
+	for i := 0; i < binary.MaxVarintLen64; i++ {
+		b, err := r.next(1)
+		if err != nil {
+			return 0, err
+		}
+		if b[0] < 0x80 {
+			if i == binary.MaxVarintLen64-1 && b[0] > 1 {
+				return 0, errBinpackVarintOverflow
+			}
+			return x | uint64(b[0])<<s, nil
+		}
+		x |= uint64(b[0]&0x7f) << s
+		s += 7
+	}
+	return 0, errBinpackVarintOverflow
+}
+
+// binpackInsertLen inserts the uvarint length of b[start:] before it
+func binpackInsertLen(b []byte, start int) []byte {
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(b)-start))
+	b = append(b, prefix[:n]...)
+	copy(b[start+n:], b[start:len(b)-n])
+	copy(b[start:], prefix[:n])
+	return b
+}
+
+func (r *binpackReader) varint() (int64, error) {
+	ux, err := r.uvarint()
+	x := int64(ux >> 1)
+	if ux&1 != 0 {
+		x = ^x
+	}
+	return x, err
+}
+
+const binpackFrameMagic = 0x42504b31 // "BPK1"
+
+var (
+	ErrFrameMagic       = errors.New("binpack: bad frame magic")
+	ErrFrameChecksum    = errors.New("binpack: frame checksum mismatch")
+	ErrUnknownFrameType = errors.New("binpack: unknown frame type")
+)
+
+func binpackWriteFrame(w io.Writer, frameType uint16, payload []byte) error {
+	frame := make([]byte, 10, 10+len(payload)+4)
+	binary.BigEndian.PutUint32(frame, binpackFrameMagic)
+	binary.BigEndian.PutUint16(frame[4:], frameType)
+	binary.BigEndian.PutUint32(frame[6:], uint32(len(payload)))
+	frame = append(frame, payload...)
+	frame = binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(frame[4:]))
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// binpackReadFrame reads the whole frame even if its type is unknown, so the stream stays in sync.
+// io.EOF means the stream ended before the frame.
+func binpackReadFrame(r io.Reader) (uint16, []byte, error) {
+	var header [10]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	if binary.BigEndian.Uint32(header[:]) != binpackFrameMagic {
+		return 0, nil, ErrFrameMagic
+	}
+
+	frameType := binary.BigEndian.Uint16(header[4:])
+	size := binary.BigEndian.Uint32(header[6:])
+	if size > 16777216 {
+		return 0, nil, fmt.Errorf("binpack: frame length %d exceeds limit 16777216", size)
+	}
+
+	rest := make([]byte, int(size)+4)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+
+	payload := rest[:size]
+	checksum := crc32.Update(crc32.ChecksumIEEE(header[4:]), crc32.IEEETable, payload)
+	if binary.BigEndian.Uint32(rest[size:]) != checksum {
+		return 0, nil, ErrFrameChecksum
+	}
+	return frameType, payload, nil
+}
+
+// FrameDemux reads frames and passes the unpacked structs to the handlers registered for their types
+type FrameDemux struct {
+	handlers map[uint16]func(payload []byte) error
+}
+
+func (d *FrameDemux) handle(frameType uint16, fn func(payload []byte) error) {
+	if d.handlers == nil {
+		d.handlers = make(map[uint16]func(payload []byte) error)
+	}
+	d.handlers[frameType] = fn
+}
+
+// Next reads a single frame and calls its handler. Frames without a handler give ErrUnknownFrameType,
+// the stream can still be read after it.
+func (d *FrameDemux) Next(r io.Reader) error {
+	frameType, payload, err := binpackReadFrame(r)
+	if err != nil {
+		return err
+	}
+
+	fn, ok := d.handlers[frameType]
+	if !ok {
+		return fmt.Errorf("%w %d", ErrUnknownFrameType, frameType)
+	}
+	return fn(payload)
+}
 
 func (in *User) Unpack(data []byte) error {
-	r := bytes.NewReader(data)
+	return in.unpack(&binpackReader{data: data})
+}
+
+// UnpackFrom reads exactly one User from the stream, io.EOF means the stream ended before it
+func (in *User) UnpackFrom(r io.Reader) error {
+	scratch := binpackScratch.Get().(*[64]byte)
+	defer binpackScratch.Put(scratch)
+
+	br := binpackReader{src: r, buf: scratch[:]}
+	err := in.unpack(&br)
+	if br.read == 0 && errors.Is(err, io.ErrUnexpectedEOF) {
+		return io.EOF
+	}
+	return err
+}
+
+func (in *User) Pack() ([]byte, error) {
+	return in.appendPack(nil)
+}
+
+// AppendPack appends packed User to dst. It panics on values Pack rejects,
+// AppendBinary returns the error instead.
+func (in *User) AppendPack(dst []byte) []byte {
+	b, err := in.appendPack(dst)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// BinpackOptions returns options of the cgen comment
+func (in *User) BinpackOptions() string {
+	return "frame=1"
+}
+
+const UserFrameType = 1
+
+// WriteFrame writes packed User as a single frame
+func (in *User) WriteFrame(w io.Writer) error {
+	payload, err := in.Pack()
+	if err != nil {
+		return err
+	}
+	return binpackWriteFrame(w, UserFrameType, payload)
+}
+
+// ReadFrame reads a single frame, it must be a User frame
+func (in *User) ReadFrame(r io.Reader) error {
+	frameType, payload, err := binpackReadFrame(r)
+	if err != nil {
+		return err
+	}
+	if frameType != UserFrameType {
+		return fmt.Errorf("User: %w %d", ErrUnknownFrameType, frameType)
+	}
+	return in.Unpack(payload)
+}
+
+// HandleUser registers the handler for User frames
+func (d *FrameDemux) HandleUser(fn func(in *User) error) {
+	d.handle(UserFrameType, func(payload []byte) error {
+		in := &User{}
+		if err := in.Unpack(payload); err != nil {
+			return err
+		}
+		return fn(in)
+	})
+}
+
+func (in *User) unpack(r *binpackReader) error {
 
 	// ID
-	var IDRaw uint32
-	binary.Read(r, binary.LittleEndian, &IDRaw)
-	in.ID = int(IDRaw)
+	{
+		IDBytes, err := r.next(4)
+		if err != nil {
+			return binpackError("User", "ID", err)
+		}
+		in.ID = int(binary.LittleEndian.Uint32(IDBytes))
+	}
 
 	// Login
-	var LoginLenRaw uint32
-	binary.Read(r, binary.LittleEndian, &LoginLenRaw)
-	LoginRaw := make([]byte, LoginLenRaw)
-	binary.Read(r, binary.LittleEndian, &LoginRaw)
-	in.Login = string(LoginRaw)
+	{
+		LoginLenBytes, err := r.next(4)
+		if err != nil {
+			return binpackError("User", "Login", err)
+		}
+		LoginLen := binary.LittleEndian.Uint32(LoginLenBytes)
+		if LoginLen > 1048576 {
+			return binpackError("User", "Login", fmt.Errorf("length %d exceeds limit 1048576", LoginLen))
+		}
+		if uint64(LoginLen) > uint64(r.remaining()) {
+			return binpackError("User", "Login", io.ErrUnexpectedEOF)
+		}
+		LoginBytes, err := r.next(int(LoginLen))
+		if err != nil {
+			return binpackError("User", "Login", err)
+		}
+		in.Login = string(LoginBytes)
+	}
 
 	// Flags
-	var FlagsRaw uint32
-	binary.Read(r, binary.LittleEndian, &FlagsRaw)
-	in.Flags = int(FlagsRaw)
+	{
+		FlagsBytes, err := r.next(4)
+		if err != nil {
+			return binpackError("User", "Flags", err)
+		}
+		in.Flags = int(binary.LittleEndian.Uint32(FlagsBytes))
+	}
 	return nil
 }
+
+func (in *User) appendPack(b []byte) ([]byte, error) {
+
+	// ID
+	{
+		if in.ID < 0 || uint64(in.ID) > math.MaxUint32 {
+			return nil, binpackError("User", "ID", fmt.Errorf("%d doesn't fit uint32", in.ID))
+		}
+		b = binary.LittleEndian.AppendUint32(b, uint32(in.ID))
+	}
+
+	// Login
+	{
+		if len(in.Login) > 1048576 {
+			return nil, binpackError("User", "Login", fmt.Errorf("length %d exceeds limit 1048576", len(in.Login)))
+		}
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(in.Login)))
+		b = append(b, in.Login...)
+	}
+
+	// Flags
+	{
+		if in.Flags < 0 || uint64(in.Flags) > math.MaxUint32 {
+			return nil, binpackError("User", "Flags", fmt.Errorf("%d doesn't fit uint32", in.Flags))
+		}
+		b = binary.LittleEndian.AppendUint32(b, uint32(in.Flags))
+	}
+	return b, nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (in *User) MarshalBinary() ([]byte, error) {
+	return in.Pack()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+func (in *User) UnmarshalBinary(data []byte) error {
+	return in.Unpack(data)
+}
+
+// AppendBinary implements encoding.BinaryAppender, dst is returned as is on error
+func (in *User) AppendBinary(dst []byte) ([]byte, error) {
+	b, err := in.appendPack(dst)
+	if err != nil {
+		return dst, err
+	}
+	return b, nil
+}
+
+func (in *Session) Unpack(data []byte) error {
+	return in.unpack(&binpackReader{data: data})
+}
+
+// UnpackFrom reads exactly one Session from the stream, io.EOF means the stream ended before it
+func (in *Session) UnpackFrom(r io.Reader) error {
+	scratch := binpackScratch.Get().(*[64]byte)
+	defer binpackScratch.Put(scratch)
+
+	br := binpackReader{src: r, buf: scratch[:]}
+	err := in.unpack(&br)
+	if br.read == 0 && errors.Is(err, io.ErrUnexpectedEOF) {
+		return io.EOF
+	}
+	return err
+}
+
+func (in *Session) Pack() ([]byte, error) {
+	return in.appendPack(nil)
+}
+
+// AppendPack appends packed Session to dst. It panics on values Pack rejects,
+// AppendBinary returns the error instead.
+func (in *Session) AppendPack(dst []byte) []byte {
+	b, err := in.appendPack(dst)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// BinpackOptions returns options of the cgen comment
+func (in *Session) BinpackOptions() string {
+	return "frame=2"
+}
+
+const SessionFrameType = 2
+
+// WriteFrame writes packed Session as a single frame
+func (in *Session) WriteFrame(w io.Writer) error {
+	payload, err := in.Pack()
+	if err != nil {
+		return err
+	}
+	return binpackWriteFrame(w, SessionFrameType, payload)
+}
+
+// ReadFrame reads a single frame, it must be a Session frame
+func (in *Session) ReadFrame(r io.Reader) error {
+	frameType, payload, err := binpackReadFrame(r)
+	if err != nil {
+		return err
+	}
+	if frameType != SessionFrameType {
+		return fmt.Errorf("Session: %w %d", ErrUnknownFrameType, frameType)
+	}
+	return in.Unpack(payload)
+}
+
+// HandleSession registers the handler for Session frames
+func (d *FrameDemux) HandleSession(fn func(in *Session) error) {
+	d.handle(SessionFrameType, func(payload []byte) error {
+		in := &Session{}
+		if err := in.Unpack(payload); err != nil {
+			return err
+		}
+		return fn(in)
+	})
+}
+
+func (in *Session) unpack(r *binpackReader) error {
+
+	// UserID
+	{
+		UserIDBytes, err := r.next(8)
+		if err != nil {
+			return binpackError("Session", "UserID", err)
+		}
+		in.UserID = binary.LittleEndian.Uint64(UserIDBytes)
+	}
+
+	// Active
+	{
+		ActiveBytes, err := r.next(1)
+		if err != nil {
+			return binpackError("Session", "Active", err)
+		}
+		if ActiveBytes[0] > 1 {
+			return binpackError("Session", "Active", fmt.Errorf("invalid bool %d", ActiveBytes[0]))
+		}
+		in.Active = ActiveBytes[0] != 0
+	}
+
+	// Score
+	{
+		ScoreBytes, err := r.next(8)
+		if err != nil {
+			return binpackError("Session", "Score", err)
+		}
+		in.Score = math.Float64frombits(binary.LittleEndian.Uint64(ScoreBytes))
+	}
+
+	// Delta
+	{
+		DeltaBytes, err := r.next(2)
+		if err != nil {
+			return binpackError("Session", "Delta", err)
+		}
+		in.Delta = int16(binary.LittleEndian.Uint16(DeltaBytes))
+	}
+
+	// Token
+	{
+		TokenBytes, err := r.next(16)
+		if err != nil {
+			return binpackError("Session", "Token", err)
+		}
+		copy(in.Token[:], TokenBytes)
+	}
+
+	// Payload
+	{
+		PayloadLenBytes, err := r.next(4)
+		if err != nil {
+			return binpackError("Session", "Payload", err)
+		}
+		PayloadLen := binary.LittleEndian.Uint32(PayloadLenBytes)
+		if PayloadLen > 1048576 {
+			return binpackError("Session", "Payload", fmt.Errorf("length %d exceeds limit 1048576", PayloadLen))
+		}
+		if uint64(PayloadLen) > uint64(r.remaining()) {
+			return binpackError("Session", "Payload", io.ErrUnexpectedEOF)
+		}
+		PayloadBytes, err := r.next(int(PayloadLen))
+		if err != nil {
+			return binpackError("Session", "Payload", err)
+		}
+		in.Payload = make([]byte, PayloadLen)
+		copy(in.Payload, PayloadBytes)
+	}
+
+	// Roles
+	{
+		RolesLenBytes, err := r.next(4)
+		if err != nil {
+			return binpackError("Session", "Roles", err)
+		}
+		RolesLen := binary.LittleEndian.Uint32(RolesLenBytes)
+		if RolesLen > 1048576 {
+			return binpackError("Session", "Roles", fmt.Errorf("length %d exceeds limit 1048576", RolesLen))
+		}
+		if uint64(RolesLen) > uint64(r.remaining()) {
+			return binpackError("Session", "Roles", io.ErrUnexpectedEOF)
+		}
+		in.Roles = make([]string, 0, r.prealloc(uint64(RolesLen)))
+		for RolesI := 0; RolesI < int(RolesLen); RolesI++ {
+			var RolesItem string
+			RolesElemLenBytes, err := r.next(4)
+			if err != nil {
+				return binpackError("Session", "Roles", err)
+			}
+			RolesElemLen := binary.LittleEndian.Uint32(RolesElemLenBytes)
+			if RolesElemLen > 1048576 {
+				return binpackError("Session", "Roles", fmt.Errorf("length %d exceeds limit 1048576", RolesElemLen))
+			}
+			if uint64(RolesElemLen) > uint64(r.remaining()) {
+				return binpackError("Session", "Roles", io.ErrUnexpectedEOF)
+			}
+			RolesElemBytes, err := r.next(int(RolesElemLen))
+			if err != nil {
+				return binpackError("Session", "Roles", err)
+			}
+			RolesItem = string(RolesElemBytes)
+			in.Roles = append(in.Roles, RolesItem)
+		}
+	}
+
+	// Ports
+	{
+		PortsLenBytes, err := r.next(4)
+		if err != nil {
+			return binpackError("Session", "Ports", err)
+		}
+		PortsLen := binary.LittleEndian.Uint32(PortsLenBytes)
+		if PortsLen > 1048576 {
+			return binpackError("Session", "Ports", fmt.Errorf("length %d exceeds limit 1048576", PortsLen))
+		}
+		if uint64(PortsLen)*2 > uint64(r.remaining()) {
+			return binpackError("Session", "Ports", io.ErrUnexpectedEOF)
+		}
+		in.Ports = make([]uint16, 0, r.prealloc(uint64(PortsLen)))
+		for PortsI := 0; PortsI < int(PortsLen); PortsI++ {
+			var PortsItem uint16
+			PortsElemBytes, err := r.next(2)
+			if err != nil {
+				return binpackError("Session", "Ports", err)
+			}
+			PortsItem = binary.LittleEndian.Uint16(PortsElemBytes)
+			in.Ports = append(in.Ports, PortsItem)
+		}
+	}
+
+	// Owner
+	{
+		if err := in.Owner.unpack(r); err != nil {
+			return binpackError("Session", "Owner", err)
+		}
+	}
+
+	// Previous
+	{
+		PreviousPresent, err := r.next(1)
+		if err != nil {
+			return binpackError("Session", "Previous", err)
+		}
+		switch PreviousPresent[0] {
+		case 0:
+			in.Previous = nil
+		case 1:
+			in.Previous = new(Session)
+			if err := (*in.Previous).unpack(r); err != nil {
+				return binpackError("Session", "Previous", err)
+			}
+		default:
+			return binpackError("Session", "Previous", fmt.Errorf("invalid presence byte %d", PreviousPresent[0]))
+		}
+	}
+	return nil
+}
+
+func (in *Session) appendPack(b []byte) ([]byte, error) {
+
+	// UserID
+	{
+		b = binary.LittleEndian.AppendUint64(b, in.UserID)
+	}
+
+	// Active
+	{
+		if in.Active {
+			b = append(b, 1)
+		} else {
+			b = append(b, 0)
+		}
+	}
+
+	// Score
+	{
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(in.Score))
+	}
+
+	// Delta
+	{
+		b = binary.LittleEndian.AppendUint16(b, uint16(in.Delta))
+	}
+
+	// Token
+	{
+		b = append(b, in.Token[:]...)
+	}
+
+	// Payload
+	{
+		if len(in.Payload) > 1048576 {
+			return nil, binpackError("Session", "Payload", fmt.Errorf("length %d exceeds limit 1048576", len(in.Payload)))
+		}
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(in.Payload)))
+		b = append(b, in.Payload...)
+	}
+
+	// Roles
+	{
+		if len(in.Roles) > 1048576 {
+			return nil, binpackError("Session", "Roles", fmt.Errorf("length %d exceeds limit 1048576", len(in.Roles)))
+		}
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(in.Roles)))
+		for RolesI := range in.Roles {
+			if len(in.Roles[RolesI]) > 1048576 {
+				return nil, binpackError("Session", "Roles", fmt.Errorf("length %d exceeds limit 1048576", len(in.Roles[RolesI])))
+			}
+			b = binary.LittleEndian.AppendUint32(b, uint32(len(in.Roles[RolesI])))
+			b = append(b, in.Roles[RolesI]...)
+		}
+	}
+
+	// Ports
+	{
+		if len(in.Ports) > 1048576 {
+			return nil, binpackError("Session", "Ports", fmt.Errorf("length %d exceeds limit 1048576", len(in.Ports)))
+		}
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(in.Ports)))
+		for PortsI := range in.Ports {
+			b = binary.LittleEndian.AppendUint16(b, in.Ports[PortsI])
+		}
+	}
+
+	// Owner
+	{
+		OwnerPacked, err := in.Owner.appendPack(b)
+		if err != nil {
+			return nil, binpackError("Session", "Owner", err)
+		}
+		b = OwnerPacked
+	}
+
+	// Previous
+	{
+		if in.Previous == nil {
+			b = append(b, 0)
+		} else {
+			b = append(b, 1)
+			PreviousValuePacked, err := (*in.Previous).appendPack(b)
+			if err != nil {
+				return nil, binpackError("Session", "Previous", err)
+			}
+			b = PreviousValuePacked
+		}
+	}
+	return b, nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (in *Session) MarshalBinary() ([]byte, error) {
+	return in.Pack()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+func (in *Session) UnmarshalBinary(data []byte) error {
+	return in.Unpack(data)
+}
+
+// AppendBinary implements encoding.BinaryAppender, dst is returned as is on error
+func (in *Session) AppendBinary(dst []byte) ([]byte, error) {
+	b, err := in.appendPack(dst)
+	if err != nil {
+		return dst, err
+	}
+	return b, nil
+}
+
+func (in *Header) Unpack(data []byte) error {
+	return in.unpack(&binpackReader{data: data})
+}
+
+// UnpackFrom reads exactly one Header from the stream, io.EOF means the stream ended before it
+func (in *Header) UnpackFrom(r io.Reader) error {
+	scratch := binpackScratch.Get().(*[64]byte)
+	defer binpackScratch.Put(scratch)
+
+	br := binpackReader{src: r, buf: scratch[:]}
+	err := in.unpack(&br)
+	if br.read == 0 && errors.Is(err, io.ErrUnexpectedEOF) {
+		return io.EOF
+	}
+	return err
+}
+
+func (in *Header) Pack() ([]byte, error) {
+	return in.appendPack(nil)
+}
+
+// AppendPack appends packed Header to dst. It panics on values Pack rejects,
+// AppendBinary returns the error instead.
+func (in *Header) AppendPack(dst []byte) []byte {
+	b, err := in.appendPack(dst)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// BinpackOptions returns options of the cgen comment
+func (in *Header) BinpackOptions() string {
+	return "endian=big"
+}
+
+func (in *Header) unpack(r *binpackReader) error {
+
+	// Version
+	{
+		VersionBytes, err := r.next(2)
+		if err != nil {
+			return binpackError("Header", "Version", err)
+		}
+		in.Version = binary.BigEndian.Uint16(VersionBytes)
+	}
+
+	// Length
+	{
+		LengthBytes, err := r.next(4)
+		if err != nil {
+			return binpackError("Header", "Length", err)
+		}
+		in.Length = binary.BigEndian.Uint32(LengthBytes)
+	}
+
+	// Seq
+	{
+		SeqRaw, err := r.uvarint()
+		if err != nil {
+			return binpackError("Header", "Seq", err)
+		}
+		in.Seq = SeqRaw
+	}
+
+	// Offset
+	{
+		OffsetRaw, err := r.varint()
+		if err != nil {
+			return binpackError("Header", "Offset", err)
+		}
+		if OffsetRaw < math.MinInt32 || OffsetRaw > math.MaxInt32 {
+			return binpackError("Header", "Offset", fmt.Errorf("%d overflows int32", OffsetRaw))
+		}
+		in.Offset = int32(OffsetRaw)
+	}
+
+	// Name
+	{
+		NameLenBytes, err := r.next(2)
+		if err != nil {
+			return binpackError("Header", "Name", err)
+		}
+		NameLen := binary.BigEndian.Uint16(NameLenBytes)
+		if uint64(NameLen) > uint64(r.remaining()) {
+			return binpackError("Header", "Name", io.ErrUnexpectedEOF)
+		}
+		NameBytes, err := r.next(int(NameLen))
+		if err != nil {
+			return binpackError("Header", "Name", err)
+		}
+		in.Name = string(NameBytes)
+	}
+
+	// Tags
+	{
+		TagsLen, err := r.uvarint()
+		if err != nil {
+			return binpackError("Header", "Tags", err)
+		}
+		if TagsLen > 1048576 {
+			return binpackError("Header", "Tags", fmt.Errorf("length %d exceeds limit 1048576", TagsLen))
+		}
+		if uint64(TagsLen) > uint64(r.remaining()) {
+			return binpackError("Header", "Tags", io.ErrUnexpectedEOF)
+		}
+		in.Tags = make([]uint32, 0, r.prealloc(uint64(TagsLen)))
+		for TagsI := 0; TagsI < int(TagsLen); TagsI++ {
+			var TagsItem uint32
+			TagsElemRaw, err := r.uvarint()
+			if err != nil {
+				return binpackError("Header", "Tags", err)
+			}
+			if TagsElemRaw > math.MaxUint32 {
+				return binpackError("Header", "Tags", fmt.Errorf("%d overflows uint32", TagsElemRaw))
+			}
+			TagsItem = uint32(TagsElemRaw)
+			in.Tags = append(in.Tags, TagsItem)
+		}
+	}
+
+	// Checksum
+	{
+		ChecksumBytes, err := r.next(4)
+		if err != nil {
+			return binpackError("Header", "Checksum", err)
+		}
+		copy(in.Checksum[:], ChecksumBytes)
+	}
+
+	// Payload
+	{
+		PayloadLen, err := r.uvarint()
+		if err != nil {
+			return binpackError("Header", "Payload", err)
+		}
+		if PayloadLen > 1048576 {
+			return binpackError("Header", "Payload", fmt.Errorf("length %d exceeds limit 1048576", PayloadLen))
+		}
+		if uint64(PayloadLen) > uint64(r.remaining()) {
+			return binpackError("Header", "Payload", io.ErrUnexpectedEOF)
+		}
+		PayloadBytes, err := r.next(int(PayloadLen))
+		if err != nil {
+			return binpackError("Header", "Payload", err)
+		}
+		in.Payload = make([]byte, PayloadLen)
+		copy(in.Payload, PayloadBytes)
+	}
+	return nil
+}
+
+func (in *Header) appendPack(b []byte) ([]byte, error) {
+
+	// Version
+	{
+		b = binary.BigEndian.AppendUint16(b, in.Version)
+	}
+
+	// Length
+	{
+		b = binary.BigEndian.AppendUint32(b, in.Length)
+	}
+
+	// Seq
+	{
+		b = binary.AppendUvarint(b, in.Seq)
+	}
+
+	// Offset
+	{
+		b = binary.AppendVarint(b, int64(in.Offset))
+	}
+
+	// Name
+	{
+		if len(in.Name) > 65535 {
+			return nil, binpackError("Header", "Name", fmt.Errorf("length %d exceeds limit 65535", len(in.Name)))
+		}
+		b = binary.BigEndian.AppendUint16(b, uint16(len(in.Name)))
+		b = append(b, in.Name...)
+	}
+
+	// Tags
+	{
+		if len(in.Tags) > 1048576 {
+			return nil, binpackError("Header", "Tags", fmt.Errorf("length %d exceeds limit 1048576", len(in.Tags)))
+		}
+		b = binary.AppendUvarint(b, uint64(len(in.Tags)))
+		for TagsI := range in.Tags {
+			b = binary.AppendUvarint(b, uint64(in.Tags[TagsI]))
+		}
+	}
+
+	// Checksum
+	{
+		b = append(b, in.Checksum[:]...)
+	}
+
+	// Payload
+	{
+		if len(in.Payload) > 1048576 {
+			return nil, binpackError("Header", "Payload", fmt.Errorf("length %d exceeds limit 1048576", len(in.Payload)))
+		}
+		b = binary.AppendUvarint(b, uint64(len(in.Payload)))
+		b = append(b, in.Payload...)
+	}
+	return b, nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (in *Header) MarshalBinary() ([]byte, error) {
+	return in.Pack()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+func (in *Header) UnmarshalBinary(data []byte) error {
+	return in.Unpack(data)
+}
+
+// AppendBinary implements encoding.BinaryAppender, dst is returned as is on error
+func (in *Header) AppendBinary(dst []byte) ([]byte, error) {
+	b, err := in.appendPack(dst)
+	if err != nil {
+		return dst, err
+	}
+	return b, nil
+}
+
+func (in *Profile) Unpack(data []byte) error {
+	return in.unpack(&binpackReader{data: data})
+}
+
+// UnpackFrom reads exactly one Profile from the stream, io.EOF means the stream ended before it
+func (in *Profile) UnpackFrom(r io.Reader) error {
+	scratch := binpackScratch.Get().(*[64]byte)
+	defer binpackScratch.Put(scratch)
+
+	br := binpackReader{src: r, buf: scratch[:]}
+	err := in.unpack(&br)
+	if br.read == 0 && errors.Is(err, io.ErrUnexpectedEOF) {
+		return io.EOF
+	}
+	return err
+}
+
+func (in *Profile) Pack() ([]byte, error) {
+	return in.appendPack(nil)
+}
+
+// AppendPack appends packed Profile to dst. It panics on values Pack rejects,
+// AppendBinary returns the error instead.
+func (in *Profile) AppendPack(dst []byte) []byte {
+	b, err := in.appendPack(dst)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// BinpackOptions returns options of the cgen comment
+func (in *Profile) BinpackOptions() string {
+	return "version=2"
+}
+
+func (in *Profile) unpack(r *binpackReader) error {
+	// any version is accepted, unknown fields are skipped
+	if _, err := r.uvarint(); err != nil {
+		return binpackError("Profile", "version", err)
+	}
+	versionedLen, err := r.uvarint()
+	if err != nil {
+		return binpackError("Profile", "length", err)
+	}
+	if versionedLen > 1048576 {
+		return binpackError("Profile", "length", fmt.Errorf("length %d exceeds limit 1048576", versionedLen))
+	}
+	if versionedLen > uint64(r.remaining()) {
+		return binpackError("Profile", "length", io.ErrUnexpectedEOF)
+	}
+	versionedBody, err := r.next(int(versionedLen))
+	if err != nil {
+		return binpackError("Profile", "length", err)
+	}
+	versionedFields := &binpackReader{data: versionedBody}
+
+	// fields missing in the payload keep these values
+	in.Login = ""
+	in.Age = 0
+	in.Lang = "en"
+
+	for versionedFields.remaining() > 0 {
+		fieldNum, err := versionedFields.uvarint()
+		if err != nil {
+			return binpackError("Profile", "field number", err)
+		}
+		fieldLen, err := versionedFields.uvarint()
+		if err != nil {
+			return binpackError("Profile", "field length", err)
+		}
+		if fieldLen > uint64(versionedFields.remaining()) {
+			return binpackError("Profile", "field length", io.ErrUnexpectedEOF)
+		}
+		fieldValue, _ := versionedFields.next(int(fieldLen))
+
+		switch fieldNum {
+		case 1: // Login
+			r := &binpackReader{data: fieldValue}
+			LoginLenBytes, err := r.next(4)
+			if err != nil {
+				return binpackError("Profile", "Login", err)
+			}
+			LoginLen := binary.LittleEndian.Uint32(LoginLenBytes)
+			if LoginLen > 1048576 {
+				return binpackError("Profile", "Login", fmt.Errorf("length %d exceeds limit 1048576", LoginLen))
+			}
+			if uint64(LoginLen) > uint64(r.remaining()) {
+				return binpackError("Profile", "Login", io.ErrUnexpectedEOF)
+			}
+			LoginBytes, err := r.next(int(LoginLen))
+			if err != nil {
+				return binpackError("Profile", "Login", err)
+			}
+			in.Login = string(LoginBytes)
+		case 2: // Age
+			r := &binpackReader{data: fieldValue}
+			AgeRaw, err := r.varint()
+			if err != nil {
+				return binpackError("Profile", "Age", err)
+			}
+			if AgeRaw < math.MinInt || AgeRaw > math.MaxInt {
+				return binpackError("Profile", "Age", fmt.Errorf("%d overflows int", AgeRaw))
+			}
+			in.Age = int(AgeRaw)
+		case 3: // Lang
+			r := &binpackReader{data: fieldValue}
+			LangLenBytes, err := r.next(4)
+			if err != nil {
+				return binpackError("Profile", "Lang", err)
+			}
+			LangLen := binary.LittleEndian.Uint32(LangLenBytes)
+			if LangLen > 1048576 {
+				return binpackError("Profile", "Lang", fmt.Errorf("length %d exceeds limit 1048576", LangLen))
+			}
+			if uint64(LangLen) > uint64(r.remaining()) {
+				return binpackError("Profile", "Lang", io.ErrUnexpectedEOF)
+			}
+			LangBytes, err := r.next(int(LangLen))
+			if err != nil {
+				return binpackError("Profile", "Lang", err)
+			}
+			in.Lang = string(LangBytes)
+		}
+	}
+	return nil
+}
+
+func (in *Profile) appendPack(b []byte) ([]byte, error) {
+	b = binary.AppendUvarint(b, 2) // version
+	versionedStart := len(b)
+
+	// Login
+	{
+		b = binary.AppendUvarint(b, 1)
+		LoginStart := len(b)
+		if len(in.Login) > 1048576 {
+			return nil, binpackError("Profile", "Login", fmt.Errorf("length %d exceeds limit 1048576", len(in.Login)))
+		}
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(in.Login)))
+		b = append(b, in.Login...)
+		b = binpackInsertLen(b, LoginStart)
+	}
+
+	// Age
+	{
+		b = binary.AppendUvarint(b, 2)
+		AgeStart := len(b)
+		b = binary.AppendVarint(b, int64(in.Age))
+		b = binpackInsertLen(b, AgeStart)
+	}
+
+	// Lang
+	{
+		b = binary.AppendUvarint(b, 3)
+		LangStart := len(b)
+		if len(in.Lang) > 1048576 {
+			return nil, binpackError("Profile", "Lang", fmt.Errorf("length %d exceeds limit 1048576", len(in.Lang)))
+		}
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(in.Lang)))
+		b = append(b, in.Lang...)
+		b = binpackInsertLen(b, LangStart)
+	}
+
+	if len(b)-versionedStart > 1048576 {
+		return nil, binpackError("Profile", "length", fmt.Errorf("length %d exceeds limit 1048576", len(b)-versionedStart))
+	}
+	b = binpackInsertLen(b, versionedStart)
+	return b, nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (in *Profile) MarshalBinary() ([]byte, error) {
+	return in.Pack()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+func (in *Profile) UnmarshalBinary(data []byte) error {
+	return in.Unpack(data)
+}
+
+// AppendBinary implements encoding.BinaryAppender, dst is returned as is on error
+func (in *Profile) AppendBinary(dst []byte) ([]byte, error) {
+	b, err := in.appendPack(dst)
+	if err != nil {
+		return dst, err
+	}
+	return b, nil
+}
+
+func (in *ProfileV1) Unpack(data []byte) error {
+	return in.unpack(&binpackReader{data: data})
+}
+
+// UnpackFrom reads exactly one ProfileV1 from the stream, io.EOF means the stream ended before it
+func (in *ProfileV1) UnpackFrom(r io.Reader) error {
+	scratch := binpackScratch.Get().(*[64]byte)
+	defer binpackScratch.Put(scratch)
+
+	br := binpackReader{src: r, buf: scratch[:]}
+	err := in.unpack(&br)
+	if br.read == 0 && errors.Is(err, io.ErrUnexpectedEOF) {
+		return io.EOF
+	}
+	return err
+}
+
+func (in *ProfileV1) Pack() ([]byte, error) {
+	return in.appendPack(nil)
+}
+
+// AppendPack appends packed ProfileV1 to dst. It panics on values Pack rejects,
+// AppendBinary returns the error instead.
+func (in *ProfileV1) AppendPack(dst []byte) []byte {
+	b, err := in.appendPack(dst)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// BinpackOptions returns options of the cgen comment
+func (in *ProfileV1) BinpackOptions() string {
+	return "version=1"
+}
+
+func (in *ProfileV1) unpack(r *binpackReader) error {
+	// any version is accepted, unknown fields are skipped
+	if _, err := r.uvarint(); err != nil {
+		return binpackError("ProfileV1", "version", err)
+	}
+	versionedLen, err := r.uvarint()
+	if err != nil {
+		return binpackError("ProfileV1", "length", err)
+	}
+	if versionedLen > 1048576 {
+		return binpackError("ProfileV1", "length", fmt.Errorf("length %d exceeds limit 1048576", versionedLen))
+	}
+	if versionedLen > uint64(r.remaining()) {
+		return binpackError("ProfileV1", "length", io.ErrUnexpectedEOF)
+	}
+	versionedBody, err := r.next(int(versionedLen))
+	if err != nil {
+		return binpackError("ProfileV1", "length", err)
+	}
+	versionedFields := &binpackReader{data: versionedBody}
+
+	// fields missing in the payload keep these values
+	in.Login = ""
+	in.Age = 0
+
+	for versionedFields.remaining() > 0 {
+		fieldNum, err := versionedFields.uvarint()
+		if err != nil {
+			return binpackError("ProfileV1", "field number", err)
+		}
+		fieldLen, err := versionedFields.uvarint()
+		if err != nil {
+			return binpackError("ProfileV1", "field length", err)
+		}
+		if fieldLen > uint64(versionedFields.remaining()) {
+			return binpackError("ProfileV1", "field length", io.ErrUnexpectedEOF)
+		}
+		fieldValue, _ := versionedFields.next(int(fieldLen))
+
+		switch fieldNum {
+		case 1: // Login
+			r := &binpackReader{data: fieldValue}
+			LoginLenBytes, err := r.next(4)
+			if err != nil {
+				return binpackError("ProfileV1", "Login", err)
+			}
+			LoginLen := binary.LittleEndian.Uint32(LoginLenBytes)
+			if LoginLen > 1048576 {
+				return binpackError("ProfileV1", "Login", fmt.Errorf("length %d exceeds limit 1048576", LoginLen))
+			}
+			if uint64(LoginLen) > uint64(r.remaining()) {
+				return binpackError("ProfileV1", "Login", io.ErrUnexpectedEOF)
+			}
+			LoginBytes, err := r.next(int(LoginLen))
+			if err != nil {
+				return binpackError("ProfileV1", "Login", err)
+			}
+			in.Login = string(LoginBytes)
+		case 2: // Age
+			r := &binpackReader{data: fieldValue}
+			AgeRaw, err := r.varint()
+			if err != nil {
+				return binpackError("ProfileV1", "Age", err)
+			}
+			if AgeRaw < math.MinInt || AgeRaw > math.MaxInt {
+				return binpackError("ProfileV1", "Age", fmt.Errorf("%d overflows int", AgeRaw))
+			}
+			in.Age = int(AgeRaw)
+		}
+	}
+	return nil
+}
+
+func (in *ProfileV1) appendPack(b []byte) ([]byte, error) {
+	b = binary.AppendUvarint(b, 1) // version
+	versionedStart := len(b)
+
+	// Login
+	{
+		b = binary.AppendUvarint(b, 1)
+		LoginStart := len(b)
+		if len(in.Login) > 1048576 {
+			return nil, binpackError("ProfileV1", "Login", fmt.Errorf("length %d exceeds limit 1048576", len(in.Login)))
+		}
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(in.Login)))
+		b = append(b, in.Login...)
+		b = binpackInsertLen(b, LoginStart)
+	}
+
+	// Age
+	{
+		b = binary.AppendUvarint(b, 2)
+		AgeStart := len(b)
+		b = binary.AppendVarint(b, int64(in.Age))
+		b = binpackInsertLen(b, AgeStart)
+	}
+
+	if len(b)-versionedStart > 1048576 {
+		return nil, binpackError("ProfileV1", "length", fmt.Errorf("length %d exceeds limit 1048576", len(b)-versionedStart))
+	}
+	b = binpackInsertLen(b, versionedStart)
+	return b, nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (in *ProfileV1) MarshalBinary() ([]byte, error) {
+	return in.Pack()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+func (in *ProfileV1) UnmarshalBinary(data []byte) error {
+	return in.Unpack(data)
+}
+
+// AppendBinary implements encoding.BinaryAppender, dst is returned as is on error
+func (in *ProfileV1) AppendBinary(dst []byte) ([]byte, error) {
+	b, err := in.appendPack(dst)
+	if err != nil {
+		return dst, err
+	}
+	return b, nil
+}
+
+func (in *Team) Unpack(data []byte) error {
+	return in.unpack(&binpackReader{data: data})
+}
+
+// UnpackFrom reads exactly one Team from the stream, io.EOF means the stream ended before it
+func (in *Team) UnpackFrom(r io.Reader) error {
+	scratch := binpackScratch.Get().(*[64]byte)
+	defer binpackScratch.Put(scratch)
+
+	br := binpackReader{src: r, buf: scratch[:]}
+	err := in.unpack(&br)
+	if br.read == 0 && errors.Is(err, io.ErrUnexpectedEOF) {
+		return io.EOF
+	}
+	return err
+}
+
+func (in *Team) Pack() ([]byte, error) {
+	return in.appendPack(nil)
+}
+
+// AppendPack appends packed Team to dst. It panics on values Pack rejects,
+// AppendBinary returns the error instead.
+func (in *Team) AppendPack(dst []byte) []byte {
+	b, err := in.appendPack(dst)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (in *Team) unpack(r *binpackReader) error {
+
+	// Name
+	{
+		NameLenBytes, err := r.next(4)
+		if err != nil {
+			return binpackError("Team", "Name", err)
+		}
+		NameLen := binary.LittleEndian.Uint32(NameLenBytes)
+		if NameLen > 1048576 {
+			return binpackError("Team", "Name", fmt.Errorf("length %d exceeds limit 1048576", NameLen))
+		}
+		if uint64(NameLen) > uint64(r.remaining()) {
+			return binpackError("Team", "Name", io.ErrUnexpectedEOF)
+		}
+		NameBytes, err := r.next(int(NameLen))
+		if err != nil {
+			return binpackError("Team", "Name", err)
+		}
+		in.Name = string(NameBytes)
+	}
+
+	// Members
+	{
+		MembersLenBytes, err := r.next(4)
+		if err != nil {
+			return binpackError("Team", "Members", err)
+		}
+		MembersLen := binary.LittleEndian.Uint32(MembersLenBytes)
+		if MembersLen > 1048576 {
+			return binpackError("Team", "Members", fmt.Errorf("length %d exceeds limit 1048576", MembersLen))
+		}
+		if uint64(MembersLen) > uint64(r.remaining()) {
+			return binpackError("Team", "Members", io.ErrUnexpectedEOF)
+		}
+		in.Members = make([]User, 0, r.prealloc(uint64(MembersLen)))
+		for MembersI := 0; MembersI < int(MembersLen); MembersI++ {
+			var MembersItem User
+			if err := MembersItem.unpack(r); err != nil {
+				return binpackError("Team", "Members", err)
+			}
+			in.Members = append(in.Members, MembersItem)
+		}
+	}
+	return nil
+}
+
+func (in *Team) appendPack(b []byte) ([]byte, error) {
+
+	// Name
+	{
+		if len(in.Name) > 1048576 {
+			return nil, binpackError("Team", "Name", fmt.Errorf("length %d exceeds limit 1048576", len(in.Name)))
+		}
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(in.Name)))
+		b = append(b, in.Name...)
+	}
+
+	// Members
+	{
+		if len(in.Members) > 1048576 {
+			return nil, binpackError("Team", "Members", fmt.Errorf("length %d exceeds limit 1048576", len(in.Members)))
+		}
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(in.Members)))
+		for MembersI := range in.Members {
+			MembersElemPacked, err := in.Members[MembersI].appendPack(b)
+			if err != nil {
+				return nil, binpackError("Team", "Members", err)
+			}
+			b = MembersElemPacked
+		}
+	}
+	return b, nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (in *Team) MarshalBinary() ([]byte, error) {
+	return in.Pack()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+func (in *Team) UnmarshalBinary(data []byte) error {
+	return in.Unpack(data)
+}
+
+// AppendBinary implements encoding.BinaryAppender, dst is returned as is on error
+func (in *Team) AppendBinary(dst []byte) ([]byte, error) {
+	b, err := in.appendPack(dst)
+	if err != nil {
+		return dst, err
+	}
+	return b, nil
+}
@@ -0,0 +1,290 @@
+// Code generated by codegen. DO NOT EDIT.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzUserRoundTrip(f *testing.F) {
+	seed, err := (&User{}).Pack()
+	if err != nil {
+		f.Fatalf("User.Pack: %v", err)
+	}
+	f.Add(seed)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		in := &User{}
+		if err := in.Unpack(data); err != nil {
+			return
+		}
+
+		packed, err := in.Pack()
+		if err != nil {
+			t.Fatalf("User.Pack: %v", err)
+		}
+
+		out := &User{}
+		if err := out.Unpack(packed); err != nil {
+			t.Fatalf("User.Unpack: %v", err)
+		}
+
+		// the stream gives the same value and reads nothing after it
+		stream := bytes.NewReader(append(packed, 0xff))
+		streamed := &User{}
+		if err := streamed.UnpackFrom(stream); err != nil {
+			t.Fatalf("User.UnpackFrom: %v", err)
+		}
+		if stream.Len() != 1 {
+			t.Fatalf("User.UnpackFrom left %d bytes, want 1", stream.Len())
+		}
+		if streamedPacked, err := streamed.Pack(); err != nil || !bytes.Equal(packed, streamedPacked) {
+			t.Fatalf("User.UnpackFrom mismatch: %v\nwant: %v\ngot:  %v", err, packed, streamedPacked)
+		}
+
+		repacked, err := out.Pack()
+		if err != nil {
+			t.Fatalf("User.Pack: %v", err)
+		}
+
+		if !bytes.Equal(packed, repacked) {
+			t.Fatalf("User round trip mismatch\nfirst:  %v\nsecond: %v", packed, repacked)
+		}
+	})
+}
+
+func FuzzSessionRoundTrip(f *testing.F) {
+	seed, err := (&Session{}).Pack()
+	if err != nil {
+		f.Fatalf("Session.Pack: %v", err)
+	}
+	f.Add(seed)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		in := &Session{}
+		if err := in.Unpack(data); err != nil {
+			return
+		}
+
+		packed, err := in.Pack()
+		if err != nil {
+			t.Fatalf("Session.Pack: %v", err)
+		}
+
+		out := &Session{}
+		if err := out.Unpack(packed); err != nil {
+			t.Fatalf("Session.Unpack: %v", err)
+		}
+
+		// the stream gives the same value and reads nothing after it
+		stream := bytes.NewReader(append(packed, 0xff))
+		streamed := &Session{}
+		if err := streamed.UnpackFrom(stream); err != nil {
+			t.Fatalf("Session.UnpackFrom: %v", err)
+		}
+		if stream.Len() != 1 {
+			t.Fatalf("Session.UnpackFrom left %d bytes, want 1", stream.Len())
+		}
+		if streamedPacked, err := streamed.Pack(); err != nil || !bytes.Equal(packed, streamedPacked) {
+			t.Fatalf("Session.UnpackFrom mismatch: %v\nwant: %v\ngot:  %v", err, packed, streamedPacked)
+		}
+
+		repacked, err := out.Pack()
+		if err != nil {
+			t.Fatalf("Session.Pack: %v", err)
+		}
+
+		if !bytes.Equal(packed, repacked) {
+			t.Fatalf("Session round trip mismatch\nfirst:  %v\nsecond: %v", packed, repacked)
+		}
+	})
+}
+
+func FuzzHeaderRoundTrip(f *testing.F) {
+	seed, err := (&Header{}).Pack()
+	if err != nil {
+		f.Fatalf("Header.Pack: %v", err)
+	}
+	f.Add(seed)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		in := &Header{}
+		if err := in.Unpack(data); err != nil {
+			return
+		}
+
+		packed, err := in.Pack()
+		if err != nil {
+			t.Fatalf("Header.Pack: %v", err)
+		}
+
+		out := &Header{}
+		if err := out.Unpack(packed); err != nil {
+			t.Fatalf("Header.Unpack: %v", err)
+		}
+
+		// the stream gives the same value and reads nothing after it
+		stream := bytes.NewReader(append(packed, 0xff))
+		streamed := &Header{}
+		if err := streamed.UnpackFrom(stream); err != nil {
+			t.Fatalf("Header.UnpackFrom: %v", err)
+		}
+		if stream.Len() != 1 {
+			t.Fatalf("Header.UnpackFrom left %d bytes, want 1", stream.Len())
+		}
+		if streamedPacked, err := streamed.Pack(); err != nil || !bytes.Equal(packed, streamedPacked) {
+			t.Fatalf("Header.UnpackFrom mismatch: %v\nwant: %v\ngot:  %v", err, packed, streamedPacked)
+		}
+
+		repacked, err := out.Pack()
+		if err != nil {
+			t.Fatalf("Header.Pack: %v", err)
+		}
+
+		if !bytes.Equal(packed, repacked) {
+			t.Fatalf("Header round trip mismatch\nfirst:  %v\nsecond: %v", packed, repacked)
+		}
+	})
+}
+
+func FuzzProfileRoundTrip(f *testing.F) {
+	seed, err := (&Profile{}).Pack()
+	if err != nil {
+		f.Fatalf("Profile.Pack: %v", err)
+	}
+	f.Add(seed)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		in := &Profile{}
+		if err := in.Unpack(data); err != nil {
+			return
+		}
+
+		packed, err := in.Pack()
+		if err != nil {
+			t.Fatalf("Profile.Pack: %v", err)
+		}
+
+		out := &Profile{}
+		if err := out.Unpack(packed); err != nil {
+			t.Fatalf("Profile.Unpack: %v", err)
+		}
+
+		// the stream gives the same value and reads nothing after it
+		stream := bytes.NewReader(append(packed, 0xff))
+		streamed := &Profile{}
+		if err := streamed.UnpackFrom(stream); err != nil {
+			t.Fatalf("Profile.UnpackFrom: %v", err)
+		}
+		if stream.Len() != 1 {
+			t.Fatalf("Profile.UnpackFrom left %d bytes, want 1", stream.Len())
+		}
+		if streamedPacked, err := streamed.Pack(); err != nil || !bytes.Equal(packed, streamedPacked) {
+			t.Fatalf("Profile.UnpackFrom mismatch: %v\nwant: %v\ngot:  %v", err, packed, streamedPacked)
+		}
+
+		repacked, err := out.Pack()
+		if err != nil {
+			t.Fatalf("Profile.Pack: %v", err)
+		}
+
+		if !bytes.Equal(packed, repacked) {
+			t.Fatalf("Profile round trip mismatch\nfirst:  %v\nsecond: %v", packed, repacked)
+		}
+	})
+}
+
+func FuzzProfileV1RoundTrip(f *testing.F) {
+	seed, err := (&ProfileV1{}).Pack()
+	if err != nil {
+		f.Fatalf("ProfileV1.Pack: %v", err)
+	}
+	f.Add(seed)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		in := &ProfileV1{}
+		if err := in.Unpack(data); err != nil {
+			return
+		}
+
+		packed, err := in.Pack()
+		if err != nil {
+			t.Fatalf("ProfileV1.Pack: %v", err)
+		}
+
+		out := &ProfileV1{}
+		if err := out.Unpack(packed); err != nil {
+			t.Fatalf("ProfileV1.Unpack: %v", err)
+		}
+
+		// the stream gives the same value and reads nothing after it
+		stream := bytes.NewReader(append(packed, 0xff))
+		streamed := &ProfileV1{}
+		if err := streamed.UnpackFrom(stream); err != nil {
+			t.Fatalf("ProfileV1.UnpackFrom: %v", err)
+		}
+		if stream.Len() != 1 {
+			t.Fatalf("ProfileV1.UnpackFrom left %d bytes, want 1", stream.Len())
+		}
+		if streamedPacked, err := streamed.Pack(); err != nil || !bytes.Equal(packed, streamedPacked) {
+			t.Fatalf("ProfileV1.UnpackFrom mismatch: %v\nwant: %v\ngot:  %v", err, packed, streamedPacked)
+		}
+
+		repacked, err := out.Pack()
+		if err != nil {
+			t.Fatalf("ProfileV1.Pack: %v", err)
+		}
+
+		if !bytes.Equal(packed, repacked) {
+			t.Fatalf("ProfileV1 round trip mismatch\nfirst:  %v\nsecond: %v", packed, repacked)
+		}
+	})
+}
+
+func FuzzTeamRoundTrip(f *testing.F) {
+	seed, err := (&Team{}).Pack()
+	if err != nil {
+		f.Fatalf("Team.Pack: %v", err)
+	}
+	f.Add(seed)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		in := &Team{}
+		if err := in.Unpack(data); err != nil {
+			return
+		}
+
+		packed, err := in.Pack()
+		if err != nil {
+			t.Fatalf("Team.Pack: %v", err)
+		}
+
+		out := &Team{}
+		if err := out.Unpack(packed); err != nil {
+			t.Fatalf("Team.Unpack: %v", err)
+		}
+
+		// the stream gives the same value and reads nothing after it
+		stream := bytes.NewReader(append(packed, 0xff))
+		streamed := &Team{}
+		if err := streamed.UnpackFrom(stream); err != nil {
+			t.Fatalf("Team.UnpackFrom: %v", err)
+		}
+		if stream.Len() != 1 {
+			t.Fatalf("Team.UnpackFrom left %d bytes, want 1", stream.Len())
+		}
+		if streamedPacked, err := streamed.Pack(); err != nil || !bytes.Equal(packed, streamedPacked) {
+			t.Fatalf("Team.UnpackFrom mismatch: %v\nwant: %v\ngot:  %v", err, packed, streamedPacked)
+		}
+
+		repacked, err := out.Pack()
+		if err != nil {
+			t.Fatalf("Team.Pack: %v", err)
+		}
+
+		if !bytes.Equal(packed, repacked) {
+			t.Fatalf("Team round trip mismatch\nfirst:  %v\nsecond: %v", packed, repacked)
+		}
+	})
+}
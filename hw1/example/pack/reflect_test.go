@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AlexeyKremsa/coursera-homework/hw1/example/lib/pack"
+)
+
+type binpacker interface {
+	Unpack(data []byte) error
+	Pack() ([]byte, error)
+}
+
+// crossCheck unpacks the data with the generated code and with the reflection codec,
+// both must fail with the same error or give the same value, which packs into the same bytes with both
+func crossCheck(t *testing.T, data []byte, generated, reflected binpacker) {
+	t.Helper()
+
+	errGenerated := generated.Unpack(data)
+	errReflected := pack.Unmarshal(data, reflected)
+	if errGenerated != nil || errReflected != nil {
+		if errGenerated == nil || errReflected == nil || errGenerated.Error() != errReflected.Error() {
+			t.Fatalf("Unpack error %v, Unmarshal error %v", errGenerated, errReflected)
+		}
+		return
+	}
+
+	// NaN isn't equal to itself, so values packed into the same bytes are equal too
+	packed, errGenerated := generated.Pack()
+	marshaled, errReflected := pack.Marshal(reflected)
+	if !reflect.DeepEqual(generated, reflected) && !bytes.Equal(packed, marshaled) {
+		t.Fatalf("Unpack and Unmarshal differ:\n%+v\n%+v", generated, reflected)
+	}
+	if errGenerated != nil || errReflected != nil {
+		if errGenerated == nil || errReflected == nil || errGenerated.Error() != errReflected.Error() {
+			t.Fatalf("Pack error %v, Marshal error %v", errGenerated, errReflected)
+		}
+		return
+	}
+	if !bytes.Equal(packed, marshaled) {
+		t.Fatalf("Pack and Marshal differ:\n%v\n%v", packed, marshaled)
+	}
+}
+
+var reflectSamples = []binpacker{
+	&benchUser,
+	&benchSession,
+	&Session{Token: [16]byte{1, 2, 3}, Delta: -7, Previous: &Session{Score: -1.5, Owner: User{Login: "old"}}},
+	&Header{Version: 2, Length: 100, Seq: 300, Offset: -5, Name: "ping", Tags: []uint32{1, 1000},
+		Checksum: [4]byte{0xde, 0xad, 0xbe, 0xef}, Payload: []byte{0x80, 0xff, 1}},
+	&Profile{Login: "v.romanov", Age: 30, Lang: "ru"},
+	&ProfileV1{Login: "v.romanov"},
+	&Team{Name: "core", Members: []User{benchUser, {ID: 2, Login: "second"}}},
+}
+
+func TestReflectMatchesGenerated(t *testing.T) {
+	for _, sample := range reflectSamples {
+		packed, err := sample.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		marshaled, err := pack.Marshal(sample)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(packed, marshaled) {
+			t.Fatalf("%T: Pack and Marshal differ:\n%v\n%v", sample, packed, marshaled)
+		}
+
+		empty := reflect.New(reflect.TypeOf(sample).Elem()).Interface().(binpacker)
+		crossCheck(t, packed, empty, reflect.New(reflect.TypeOf(sample).Elem()).Interface().(binpacker))
+
+		// truncated payloads must fail the same way
+		for i := 0; i < len(packed); i++ {
+			crossCheck(t, packed[:i],
+				reflect.New(reflect.TypeOf(sample).Elem()).Interface().(binpacker),
+				reflect.New(reflect.TypeOf(sample).Elem()).Interface().(binpacker))
+		}
+	}
+}
+
+func TestReflectPackErrors(t *testing.T) {
+	u := User{ID: -1}
+	_, errGenerated := u.Pack()
+	_, errReflected := pack.Marshal(&u)
+	if errGenerated == nil || errReflected == nil || errGenerated.Error() != errReflected.Error() {
+		t.Fatalf("Pack error %v, Marshal error %v", errGenerated, errReflected)
+	}
+}
+
+type octet byte
+
+// octetHeader is Header with named byte types, they are packed the same way as bytes
+type octetHeader struct {
+	Version  uint16
+	Length   uint32
+	Seq      uint64   `cgen:"varint"`
+	Offset   int32    `cgen:"varint"`
+	Name     string   `cgen:"u16len"`
+	Tags     []uint32 `cgen:"varint"`
+	Checksum [4]octet `cgen:"varint"`
+	Payload  []octet  `cgen:"varint"`
+}
+
+func (octetHeader) BinpackOptions() string {
+	return "endian=big"
+}
+
+func TestReflectNamedBytes(t *testing.T) {
+	h := &Header{Seq: 300, Name: "ping", Checksum: [4]byte{0xde, 0xad, 0xbe, 0xef}, Payload: []byte{0x80, 0xff, 1}}
+	packed, err := h.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := &octetHeader{}
+	if err := pack.Unmarshal(packed, o); err != nil {
+		t.Fatal(err)
+	}
+	if o.Checksum != [4]octet{0xde, 0xad, 0xbe, 0xef} || !reflect.DeepEqual(o.Payload, []octet{0x80, 0xff, 1}) {
+		t.Fatalf("unexpected bytes %v %v", o.Checksum, o.Payload)
+	}
+
+	marshaled, err := pack.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packed, marshaled) {
+		t.Fatalf("Pack and Marshal differ:\n%v\n%v", packed, marshaled)
+	}
+}
+
+func TestInvalidBool(t *testing.T) {
+	packed, err := (&Session{Active: true}).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed[8] = 2 // Active follows the 8 bytes of UserID
+
+	s := &Session{}
+	if err := s.Unpack(packed); err == nil || !strings.Contains(err.Error(), "invalid bool 2") {
+		t.Fatalf("expected invalid bool error, got %v", err)
+	}
+	crossCheck(t, packed, &Session{}, &Session{})
+}
+
+func fuzzReflect(f *testing.F, newValue func() binpacker) {
+	for _, sample := range reflectSamples {
+		if reflect.TypeOf(sample) == reflect.TypeOf(newValue()) {
+			packed, _ := sample.Pack()
+			f.Add(packed)
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		crossCheck(t, data, newValue(), newValue())
+	})
+}
+
+func FuzzReflectUser(f *testing.F) {
+	fuzzReflect(f, func() binpacker { return &User{} })
+}
+
+func FuzzReflectSession(f *testing.F) {
+	fuzzReflect(f, func() binpacker { return &Session{} })
+}
+
+func FuzzReflectHeader(f *testing.F) {
+	fuzzReflect(f, func() binpacker { return &Header{} })
+}
+
+func FuzzReflectTeam(f *testing.F) {
+	fuzzReflect(f, func() binpacker { return &Team{} })
+}
+
+func FuzzReflectProfile(f *testing.F) {
+	fuzzReflect(f, func() binpacker { return &Profile{} })
+}
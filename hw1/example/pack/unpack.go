@@ -1,10 +1,12 @@
 // go build gen/* && ./codegen.exe pack/packer.go  pack/marshaller.go
 package main
 
+//go:generate go run ../gen -o marshaller.go -schema layout.json -ksy layout.ksy .
+
 import "fmt"
 
 // lets generate code for this struct
-// cgen: binpack
+// cgen: binpack frame=1
 type User struct {
 	ID       int
 	RealName string `cgen:"-"`
@@ -12,6 +14,55 @@ type User struct {
 	Flags    int
 }
 
+// cgen: binpack frame=2
+type Session struct {
+	UserID   uint64
+	Active   bool
+	Score    float64
+	Delta    int16
+	Token    [16]byte
+	Payload  []byte
+	Roles    []string
+	Ports    []uint16
+	Owner    User
+	Previous *Session
+}
+
+// big-endian header of some network protocol
+// cgen: binpack endian=big
+type Header struct {
+	Version uint16
+	Length  uint32
+	Seq     uint64   `cgen:"varint"`
+	Offset  int32    `cgen:"varint"`
+	Name    string   `cgen:"u16len"`
+	Tags    []uint32 `cgen:"varint"`
+	// varint changes only the length of bytes, the bytes themselves are copied as is
+	Checksum [4]byte `cgen:"varint"`
+	Payload  []byte  `cgen:"varint"`
+}
+
+// numbered fields can be added and removed without breaking stored payloads
+// cgen: binpack version=2
+type Profile struct {
+	Login string `cgen:"1"`
+	Age   int    `cgen:"2,varint"`
+	Lang  string `cgen:"3,default=en"`
+}
+
+// ProfileV1 is how Profile looked before Lang was added
+// cgen: binpack version=1
+type ProfileV1 struct {
+	Login string `cgen:"1"`
+	Age   int    `cgen:"2,varint"`
+}
+
+// cgen: binpack
+type Team struct {
+	Name    string
+	Members []User
+}
+
 type Avatar struct {
 	ID  int
 	Url string
@@ -34,6 +85,68 @@ func main() {
 	}
 
 	u := User{}
-	u.Unpack(data)
-	fmt.Printf("Unpacked user %#v", u)
+	err := u.Unpack(data)
+	if err != nil {
+		fmt.Println("Unpack error:", err)
+		return
+	}
+	fmt.Printf("Unpacked user %#v\n", u)
+
+	packed, err := u.Pack()
+	if err != nil {
+		fmt.Println("Pack error:", err)
+		return
+	}
+	fmt.Printf("Packed user %v\n", packed)
+
+	s := Session{
+		UserID: 7,
+		Active: true,
+		Score:  4.5,
+		Roles:  []string{"admin", "user"},
+		Ports:  []uint16{80, 443},
+		Owner:  u,
+		Previous: &Session{
+			UserID: 6,
+		},
+	}
+	packed, err = s.Pack()
+	if err != nil {
+		fmt.Println("Pack error:", err)
+		return
+	}
+
+	s2 := Session{}
+	err = s2.Unpack(packed)
+	if err != nil {
+		fmt.Println("Unpack error:", err)
+		return
+	}
+	fmt.Printf("Unpacked session %+v, previous %+v\n", s2, *s2.Previous)
+
+	h := Header{Version: 2, Length: 100, Seq: 300, Offset: -5, Name: "ping", Tags: []uint32{1, 1000}}
+	packed, err = h.Pack()
+	if err != nil {
+		fmt.Println("Pack error:", err)
+		return
+	}
+	fmt.Printf("Packed header %v\n", packed)
+
+	old := ProfileV1{Login: "v.romanov", Age: 30}
+	packed, err = old.Pack()
+	if err != nil {
+		fmt.Println("Pack error:", err)
+		return
+	}
+
+	p := Profile{}
+	err = p.Unpack(packed)
+	if err != nil {
+		fmt.Println("Unpack error:", err)
+		return
+	}
+	fmt.Printf("Unpacked old profile as %+v\n", p)
+
+	err = (&User{}).Unpack(data[:10])
+	fmt.Println("Unpack truncated user:", err)
 }
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestProfileVersions(t *testing.T) {
+	old := ProfileV1{Login: "v.romanov", Age: 30}
+	packed, err := old.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := Profile{Lang: "ru"}
+	if err := p.Unpack(packed); err != nil {
+		t.Fatal(err)
+	}
+	if p != (Profile{Login: "v.romanov", Age: 30, Lang: "en"}) {
+		t.Fatalf("missing field must get the default, got %+v", p)
+	}
+
+	p.Lang = "ru"
+	packed, err = p.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old = ProfileV1{}
+	if err := old.Unpack(packed); err != nil {
+		t.Fatal(err)
+	}
+	if old != (ProfileV1{Login: "v.romanov", Age: 30}) {
+		t.Fatalf("unknown field must be skipped, got %+v", old)
+	}
+
+	if err := p.Unpack(packed[:len(packed)-1]); err == nil {
+		t.Fatal("expected an error for a truncated profile")
+	}
+}
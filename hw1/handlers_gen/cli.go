@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// newCliCommand builds a CLI subcommand for the handler URL, "/user/create" becomes "user create"
+func newCliCommand(h handlerTmplModel, url string, fields []Field) cliCommandModel {
+	words := strings.FieldsFunc(url, func(r rune) bool {
+		return r == '/'
+	})
+
+	funcName := ""
+	for _, w := range words {
+		for _, part := range strings.FieldsFunc(w, func(r rune) bool {
+			return r == '_' || r == '-' || r == '.'
+		}) {
+			funcName += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+
+	cmd := cliCommandModel{
+		Name:         strings.Join(words, " "),
+		FuncName:     funcName,
+		URL:          url,
+		Method:       h.Method,
+		IsProtected:  h.IsProtected,
+		IsIdempotent: h.IsIdempotent,
+	}
+
+	for _, f := range fields {
+		flag := cliFlagModel{
+			VarName:   "flag" + f.Name,
+			ParamName: strings.ToLower(f.Name),
+			Type:      f.Type,
+		}
+
+		if f.Tag != "" {
+			tags, err := parseApivalidatorTags(f.Type, f.Tag)
+			checkError(errors.Wrap(err, "newCliCommand"))
+
+			if tags.ParamName != "" {
+				flag.ParamName = strings.ToLower(tags.ParamName)
+			}
+
+			flag.Required = tags.Required
+			flag.Min = tags.Min
+			flag.Max = tags.Max
+			flag.Enum = tags.Enum
+			flag.Default = tags.DefaultString
+			if f.Type == "int" {
+				flag.Default = tags.DefaultInt
+			}
+		}
+
+		flag.Usage = cliFlagUsage(flag)
+		cmd.Flags = append(cmd.Flags, flag)
+	}
+
+	return cmd
+}
+
+func cliFlagUsage(flag cliFlagModel) string {
+	rules := []string{flag.Type}
+
+	if flag.Required {
+		rules = append(rules, "required")
+	}
+
+	prefix := ""
+	if flag.Type == "string" {
+		prefix = "len "
+	}
+
+	if flag.Min != "" {
+		rules = append(rules, prefix+">= "+flag.Min)
+	}
+
+	if flag.Max != "" {
+		rules = append(rules, prefix+"<= "+flag.Max)
+	}
+
+	if len(flag.Enum) != 0 {
+		rules = append(rules, "one of "+strings.Join(flag.Enum, "|"))
+	}
+
+	return strings.Join(rules, ", ")
+}
+
+// generateCli writes a command line client for the struct to <dir>/<struct>cli/main.go
+func generateCli(dir string, structName string, commands []cliCommandModel) {
+	model := cliTmplModel{
+		Name:       strings.ToLower(structName) + "cli",
+		StructName: structName,
+		Commands:   commands,
+	}
+
+	for _, cmd := range commands {
+		for _, flag := range cmd.Flags {
+			model.HasIntFlags = model.HasIntFlags || flag.Type == "int"
+		}
+	}
+
+	cliDir := filepath.Join(dir, model.Name)
+	err := os.MkdirAll(cliDir, 0755)
+	checkError(errors.Wrap(err, "generateCli"))
+
+	buf := &bytes.Buffer{}
+	err = cliTmpl.Execute(buf, model)
+	checkError(errors.Wrap(err, "cliTmpl"))
+
+	src, err := format.Source(buf.Bytes())
+	checkError(errors.Wrap(err, "generateCli"))
+
+	err = os.WriteFile(filepath.Join(cliDir, "main.go"), src, 0644)
+	checkError(errors.Wrap(err, "generateCli"))
+}
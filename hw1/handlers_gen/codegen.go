@@ -8,15 +8,21 @@ import (
 	"log"
 	"os"
 	"reflect"
+	"strings"
+	"time"
 )
 
 var structHandlers map[string][]handlerTmplModel
+var structCommands map[string][]cliCommandModel
 var structFields map[string][]Field
+var structServices map[string]*ApigenService
 var fieldApivalidatorTags map[string]*ApiValidatorTags
 
 func init() {
 	structHandlers = make(map[string][]handlerTmplModel)
+	structCommands = make(map[string][]cliCommandModel)
 	structFields = make(map[string][]Field)
+	structServices = make(map[string]*ApigenService)
 	fieldApivalidatorTags = make(map[string]*ApiValidatorTags)
 }
 
@@ -26,6 +32,19 @@ func checkError(err error) {
 	}
 }
 
+// checkDuplicateURLs stops generation if two methods are mounted at the same URL
+func checkDuplicateURLs(structName string, handlers []handlerTmplModel) {
+	seen := make(map[string]string)
+	for _, h := range handlers {
+		for _, url := range h.URLs {
+			if other, ok := seen[url]; ok {
+				log.Fatalf("%s: %s and %s are both mounted at %s", structName, other, h.HandlerName, url)
+			}
+			seen[url] = h.HandlerName
+		}
+	}
+}
+
 func main() {
 	out, err := os.Create("../api_generated.go")
 	checkError(err)
@@ -40,6 +59,10 @@ func main() {
 	checkError(err)
 	_, err = fmt.Fprintf(out, response, "`json:\"error\"`", "`json:\"response,omitempty\"`")
 	checkError(err)
+	_, err = fmt.Fprint(out, callWithTimeout)
+	checkError(err)
+	_, err = fmt.Fprint(out, idempotency)
+	checkError(err)
 
 	// Parse structs
 	for _, f := range node.Decls {
@@ -77,6 +100,24 @@ func main() {
 			}
 
 			structFields[fmt.Sprint(currType.Name)] = fields
+
+			// a single type declaration keeps its comment in GenDecl
+			doc := currType.Doc
+			if doc == nil {
+				doc = g.Doc
+			}
+
+			if doc != nil {
+				for _, c := range doc.List {
+					if !strings.HasPrefix(c.Text, "// apigen:service") {
+						continue
+					}
+
+					service, err := parseApigenServiceComment(strings.TrimPrefix(c.Text, "//"))
+					checkError(err)
+					structServices[currType.Name.Name] = service
+				}
+			}
 		}
 	}
 
@@ -107,12 +148,22 @@ func main() {
 					continue
 				}
 
+				service, ok := structServices[receiver]
+				if !ok {
+					service = &ApigenService{}
+				}
+
 				h := handlerTmplModel{}
 				h.HandlerName = fn.Name.Name
 				h.ReceiverType = receiver
-				h.URL = apigen.URL
+				h.URLs, h.IsProtected = resolveHandlerConfig(service, apigen)
 				h.Method = apigen.Method
-				h.IsProtected = apigen.Auth
+				h.IsIdempotent = apigen.Idempotent
+
+				if apigen.Timeout != "" {
+					h.Timeout, err = time.ParseDuration(apigen.Timeout)
+					checkError(err)
+				}
 
 				handlers, ok := structHandlers[receiver]
 				if ok {
@@ -137,6 +188,12 @@ func main() {
 					checkError(err)
 				}
 
+				// 3.1 Replay a stored response for a repeated Idempotency-Key
+				if h.IsIdempotent {
+					err = idempotencyTmpl.Execute(out, h)
+					checkError(err)
+				}
+
 				// loop through method params
 				for _, p := range fn.Type.Params.List {
 					fmt.Println("Type: ", p.Type)
@@ -167,6 +224,11 @@ func main() {
 
 					// 8. Call method
 					callMethod(out, &h)
+
+					// 9. Collect CLI subcommands, one per URL
+					for _, url := range h.URLs {
+						structCommands[receiver] = append(structCommands[receiver], newCliCommand(h, url, fields))
+					}
 				}
 			}
 		}
@@ -174,6 +236,8 @@ func main() {
 
 	// Generate ServeHttp
 	for k, v := range structHandlers {
+		checkDuplicateURLs(k, v)
+
 		model := serveHttpTmplModel{
 			StructName: k,
 			Handlers:   v,
@@ -182,4 +246,9 @@ func main() {
 		err = serveHttpTmpl.Execute(out, model)
 		checkError(err)
 	}
+
+	// Generate CLI clients
+	for k, v := range structCommands {
+		generateCli("../cmd", k, v)
+	}
 }
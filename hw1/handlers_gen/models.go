@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 type serveHttpTmplModel struct {
 	StructName string
 	Handlers   []handlerTmplModel
@@ -8,9 +10,11 @@ type serveHttpTmplModel struct {
 type handlerTmplModel struct {
 	HandlerName  string
 	ReceiverType string
-	URL          string
+	URLs         []string
 	Method       string
 	IsProtected  bool
+	IsIdempotent bool
+	Timeout      time.Duration
 }
 
 type minMaxIntTmplModel struct {
@@ -21,6 +25,7 @@ type minMaxIntTmplModel struct {
 
 type enumTmplModel struct {
 	FieldName string
+	ParamName string
 	Enum      []string
 }
 
@@ -49,8 +54,49 @@ type Field struct {
 	Tag  string
 }
 
+// ApigenComment is a method config, Auth, Prefix and Versions override ApigenService ones if set
 type ApigenComment struct {
-	URL    string `json:"url"`
-	Auth   bool   `json:"auth"`
-	Method string `json:"method"`
+	URL        string   `json:"url"`
+	Auth       *bool    `json:"auth"`
+	Method     string   `json:"method"`
+	Idempotent bool     `json:"idempotent"`
+	Timeout    string   `json:"timeout"`
+	Prefix     *string  `json:"prefix"`
+	Versions   []string `json:"versions"`
+}
+
+// ApigenService is a struct config shared by all its methods
+type ApigenService struct {
+	Prefix   string   `json:"prefix"`
+	Auth     bool     `json:"auth"`
+	Versions []string `json:"versions"`
+}
+
+type cliTmplModel struct {
+	Name        string
+	StructName  string
+	Commands    []cliCommandModel
+	HasIntFlags bool
+}
+
+type cliCommandModel struct {
+	Name         string
+	FuncName     string
+	URL          string
+	Method       string
+	IsProtected  bool
+	IsIdempotent bool
+	Flags        []cliFlagModel
+}
+
+type cliFlagModel struct {
+	VarName   string
+	ParamName string
+	Type      string
+	Usage     string
+	Required  bool
+	Default   string
+	Min       string
+	Max       string
+	Enum      []string
 }
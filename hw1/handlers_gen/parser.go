@@ -18,18 +18,26 @@ func parseReceiverType(name string) string {
 	return lastElem
 }
 
-func parseApigenComment(comment string) (*ApigenComment, error) {
+// parseApigenTag unmarshals json following the tag, e.g. `apigen:api {"url": "/user/profile"}`
+func parseApigenTag(comment string, tagName string, v interface{}) error {
 	start := strings.Index(comment, "{")
-	end := strings.Index(comment, "}")
+	end := strings.LastIndex(comment, "}")
+	if start == -1 || end < start {
+		return fmt.Errorf("invalid %s declaration: %s", tagName, comment)
+	}
 	finalStr := comment[start : end+1]
 
 	tag := strings.TrimSpace(comment[:start])
-	if tag != "apigen:api" {
-		return nil, fmt.Errorf("unknown tag: %s", tag)
+	if tag != tagName {
+		return fmt.Errorf("unknown tag: %s", tag)
 	}
 
+	return json.Unmarshal([]byte(finalStr), v)
+}
+
+func parseApigenComment(comment string) (*ApigenComment, error) {
 	apigen := &ApigenComment{}
-	err := json.Unmarshal([]byte(finalStr), apigen)
+	err := parseApigenTag(comment, "apigen:api", apigen)
 	if err != nil {
 		return nil, err
 	}
@@ -37,6 +45,47 @@ func parseApigenComment(comment string) (*ApigenComment, error) {
 	return apigen, nil
 }
 
+func parseApigenServiceComment(comment string) (*ApigenService, error) {
+	service := &ApigenService{}
+	err := parseApigenTag(comment, "apigen:service", service)
+	if err != nil {
+		return nil, err
+	}
+
+	return service, nil
+}
+
+// resolveHandlerConfig merges the method config into the struct one.
+// It returns all URLs the method is mounted at, one per API version.
+func resolveHandlerConfig(service *ApigenService, apigen *ApigenComment) ([]string, bool) {
+	prefix := service.Prefix
+	if apigen.Prefix != nil {
+		prefix = *apigen.Prefix
+	}
+
+	auth := service.Auth
+	if apigen.Auth != nil {
+		auth = *apigen.Auth
+	}
+
+	versions := service.Versions
+	if apigen.Versions != nil {
+		versions = apigen.Versions
+	}
+
+	url := strings.TrimRight(prefix, "/") + apigen.URL
+	if len(versions) == 0 {
+		return []string{url}, auth
+	}
+
+	urls := make([]string, 0, len(versions))
+	for _, v := range versions {
+		urls = append(urls, "/"+strings.Trim(v, "/")+url)
+	}
+
+	return urls, auth
+}
+
 func getApivalidatorTag(tag string) ([]string, error) {
 	if tag == "" {
 		return nil, fmt.Errorf("Empty tag, nothing to parse")
@@ -166,12 +215,14 @@ func parseApivalidatorTags(fieldType string, tag string) (*ApiValidatorTags, err
 			if strings.Contains(r, "enum") {
 				splitted := strings.Split(r, "=")
 				if len(splitted) == 0 || len(splitted) > 2 {
-					return nil, fmt.Errorf("parseApivalidatorString: invalid `max` declaration")
+					return nil, fmt.Errorf("parseApivalidatorString: invalid `enum` declaration")
 				}
 
 				roles := strings.Split(splitted[1], "|")
-				if len(roles) == 0 || len(roles) > 3 {
-					return nil, fmt.Errorf("parseApivalidatorString: invalid enum declaration")
+				for _, role := range roles {
+					if role == "" {
+						return nil, fmt.Errorf("parseApivalidatorString: invalid enum declaration")
+					}
 				}
 
 				tags.Enum = roles
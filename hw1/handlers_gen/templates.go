@@ -12,11 +12,16 @@ import (
 
 var imports = `
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 `
 
@@ -43,11 +48,222 @@ func writeResponseJSON(w http.ResponseWriter, status int, data interface{}, erro
 }
 `
 
+var callWithTimeout = `
+type methodResult struct {
+	resp interface{}
+	err  error
+}
+
+// callWithTimeout runs the method with a deadline. The method gets no access to the response writer,
+// so a method abandoned after the deadline can't write anything to the response.
+// If abandoned is set, it gets the channel the result of the abandoned method is sent to.
+func callWithTimeout(parent context.Context, timeout time.Duration, call func(ctx context.Context) (interface{}, error), abandoned func(result <-chan methodResult)) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	// buffered, so the abandoned method doesn't block forever
+	resultCh := make(chan methodResult, 1)
+	go func() {
+		resp, err := call(ctx)
+		resultCh <- methodResult{resp, err}
+	}()
+
+	select {
+	case res := <-resultCh:
+		return res.resp, res.err
+	case <-ctx.Done():
+		if abandoned != nil {
+			abandoned(resultCh)
+		}
+		return nil, ApiError{http.StatusGatewayTimeout, ctx.Err()}
+	}
+}
+`
+
+var idempotency = `
+// IdempotentResponse is a response saved for an Idempotency-Key
+type IdempotentResponse struct {
+	Fingerprint string
+	Status      int
+	Body        []byte
+}
+
+// IdempotencyStore keeps responses of idempotent endpoints, so retried requests can be replayed
+type IdempotencyStore interface {
+	// Reserve returns the saved response of the key. If there is none, the key is reserved
+	// by the caller until Set or Release and reserved is true. If another request holds the key,
+	// both results are empty.
+	Reserve(key string) (resp *IdempotentResponse, reserved bool)
+	// Set saves the response of the reserved key
+	Set(key string, resp *IdempotentResponse)
+	// Release frees the reserved key without a response, so the request can be retried
+	Release(key string)
+}
+
+// DefaultIdempotencyStore is used by generated handlers, replace it to share responses between instances
+var DefaultIdempotencyStore IdempotencyStore = NewMemoryIdempotencyStore(24 * time.Hour)
+
+// memoryIdempotencyEntry without resp is a reserved key, its request is in flight
+type memoryIdempotencyEntry struct {
+	resp      *IdempotentResponse
+	expiresAt time.Time
+}
+
+type MemoryIdempotencyStore struct {
+	ttl       time.Duration
+	entries   map[string]memoryIdempotencyEntry
+	nextSweep time.Time
+	mu        *sync.Mutex
+}
+
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		ttl:       ttl,
+		entries:   make(map[string]memoryIdempotencyEntry),
+		nextSweep: time.Now().Add(ttl),
+		mu:        &sync.Mutex{},
+	}
+}
+
+func (s *MemoryIdempotencyStore) Reserve(key string) (*IdempotentResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	entry, ok := s.entries[key]
+	if ok && now.Before(entry.expiresAt) {
+		return entry.resp, false
+	}
+
+	s.entries[key] = memoryIdempotencyEntry{expiresAt: now.Add(s.ttl)}
+	return nil, true
+}
+
+func (s *MemoryIdempotencyStore) Set(key string, resp *IdempotentResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = memoryIdempotencyEntry{
+		resp:      resp,
+		expiresAt: time.Now().Add(s.ttl),
+	}
+}
+
+func (s *MemoryIdempotencyStore) Release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[key]; ok && entry.resp == nil {
+		delete(s.entries, key)
+	}
+}
+
+// sweep deletes expired entries at most once per ttl, so a request doesn't pay for the whole map
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+
+	for k, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	s.nextSweep = now.Add(s.ttl)
+}
+
+// requestFingerprint identifies request params, form values are encoded sorted by key
+func requestFingerprint(r *http.Request) string {
+	r.ParseForm()
+	sum := sha256.Sum256([]byte(r.Form.Encode()))
+	return hex.EncodeToString(sum[:])
+}
+
+// idempotencyRecorder keeps a copy of the response to save it after the handler finishes.
+// called is set right before the method runs, responses of failed validation are not saved.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	store       IdempotencyStore
+	key         string
+	fingerprint string
+	status      int
+	body        []byte
+	called      bool
+	abandoned   bool
+}
+
+func (rec *idempotencyRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *idempotencyRecorder) Write(data []byte) (int, error) {
+	rec.body = append(rec.body, data...)
+	return rec.ResponseWriter.Write(data)
+}
+
+// finish saves the response when the handler returns, the key of an abandoned method stays reserved
+func (rec *idempotencyRecorder) finish() {
+	if rec.abandoned {
+		return
+	}
+	if !rec.called {
+		rec.store.Release(rec.key)
+		return
+	}
+	rec.save(rec.status, rec.body)
+}
+
+// abandon saves the result of the method which returns after the deadline, so a retry doesn't run it again
+func (rec *idempotencyRecorder) abandon(result <-chan methodResult) {
+	rec.abandoned = true
+	go func() {
+		res := <-result
+		status, body := methodResponse(res.resp, res.err)
+		rec.save(status, body)
+	}()
+}
+
+func (rec *idempotencyRecorder) save(status int, body []byte) {
+	// server errors are not saved, so the request can be retried
+	if status >= http.StatusInternalServerError {
+		rec.store.Release(rec.key)
+		return
+	}
+
+	rec.store.Set(rec.key, &IdempotentResponse{
+		Fingerprint: rec.fingerprint,
+		Status:      status,
+		Body:        body,
+	})
+}
+
+// methodResponse is the response the handler writes for the result of the method
+func methodResponse(resp interface{}, err error) (int, []byte) {
+	status, errorText := http.StatusOK, ""
+	if err != nil {
+		resp = nil
+		status, errorText = http.StatusInternalServerError, err.Error()
+		if apiErr, ok := err.(ApiError); ok {
+			status, errorText = apiErr.HTTPStatus, apiErr.Err.Error()
+		}
+	}
+
+	body, err := json.Marshal(response{Error: errorText, Response: resp})
+	if err != nil {
+		return http.StatusInternalServerError, []byte(err.Error())
+	}
+	return status, body
+}
+`
+
 var serveHttpTmpl = template.Must(template.New("serveHttpTmpl").Parse(`
 func (srv *{{.StructName}}) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.URL.Path { {{if .Handlers -}}
 		{{- range .Handlers}}
-		case "{{.URL}}":
+		case {{range $i, $url := .URLs}}{{if $i}}, {{end}}"{{$url}}"{{end}}:
 			srv.wrapper{{.HandlerName}}(w, r)
 		{{- end}}
 	{{- end}}
@@ -104,20 +320,44 @@ var maxStringTmpl = template.Must(template.New("maxStringTmpl").Parse(`
 	`))
 
 var enumTmpl = template.Must(template.New("enumTmpl").Parse(`
-	isStatusValid := false
-	for _, item := range statusList {
-		if item == {{.FieldName}} {
-			isStatusValid = true
-				break
-		}
-	}
-
-	if !isStatusValid {
-		writeResponseJSON(w, http.StatusBadRequest, nil, fmt.Sprintf("status must be one of [%s]", strings.Join(statusList, ", ")))
+	{{.FieldName}}Enum := map[string]bool{ {{- range $i, $v := .Enum}}{{if $i}}, {{end}}"{{$v}}": true{{end -}} }
+	if !{{.FieldName}}Enum[{{.FieldName}}] {
+		writeResponseJSON(w, http.StatusBadRequest, nil, "{{.ParamName}} must be one of [{{range $i, $v := .Enum}}{{if $i}}, {{end}}{{$v}}{{end}}]")
 		return
 	}
 `))
 
+var idempotencyTmpl = template.Must(template.New(`idempotencyTmpl`).Parse(`
+
+	var idempotencyRec *idempotencyRecorder
+	if idempotencyKey := r.Header.Get("Idempotency-Key"); idempotencyKey != "" {
+		storeKey := "{{.ReceiverType}}.{{.HandlerName}}:" + idempotencyKey
+		fingerprint := requestFingerprint(r)
+
+		store := DefaultIdempotencyStore
+		saved, reserved := store.Reserve(storeKey)
+		if saved != nil {
+			if saved.Fingerprint != fingerprint {
+				writeResponseJSON(w, http.StatusUnprocessableEntity, nil, "idempotency key is already used with different params")
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(saved.Status)
+			w.Write(saved.Body)
+			return
+		}
+		if !reserved {
+			writeResponseJSON(w, http.StatusConflict, nil, "request with this idempotency key is in progress")
+			return
+		}
+
+		idempotencyRec = &idempotencyRecorder{ResponseWriter: w, store: store, key: storeKey, fingerprint: fingerprint, status: http.StatusOK}
+		defer idempotencyRec.finish()
+		w = idempotencyRec
+	}`))
+
 var authTmpl = template.Must(template.New(`authTmpl`).Parse(`
 	if r.Header.Get("X-Auth") != "100500" {
 		writeResponseJSON(w, http.StatusForbidden, nil, "unauthorized")
@@ -137,7 +377,25 @@ var createObjTmpl = template.Must(template.New(`createObjTmpl`).Parse(`
 	`))
 
 var callMethodTmpl = template.Must(template.New(`callMethodTmpl`).Parse(`
+	{{- if .IsIdempotent}}
+	if idempotencyRec != nil {
+		idempotencyRec.called = true
+	}
+	{{- end}}
+	{{- if .Timeout}}
+	// timeout {{.Timeout}}
+	var abandoned func(result <-chan methodResult)
+	{{- if .IsIdempotent}}
+	if idempotencyRec != nil {
+		abandoned = idempotencyRec.abandon
+	}
+	{{- end}}
+	resp, err := callWithTimeout(r.Context(), time.Duration({{.Timeout.Nanoseconds}}), func(ctx context.Context) (interface{}, error) {
+		return srv.{{.HandlerName}}(ctx, paramsToPass)
+	}, abandoned)
+	{{- else}}
 	resp, err := srv.{{.HandlerName}}(r.Context(), paramsToPass)
+	{{- end}}
 	if err != nil {
 		apiErr, ok := err.(ApiError)
 		if ok {
@@ -346,14 +604,15 @@ func validateParams(out *os.File, fields []Field) {
 		if len(tags.Enum) != 0 {
 			model := enumTmplModel{
 				FieldName: f.Name,
+				ParamName: strings.ToLower(f.Name),
 				Enum:      tags.Enum,
 			}
 
-			// declare array with enums
-			_, err := fmt.Fprintf(out, fmt.Sprintf("statusList := %#v", tags.Enum))
-			checkError(errors.Wrap(err, "validateParams"))
+			if tags.ParamName != "" {
+				model.ParamName = strings.ToLower(tags.ParamName)
+			}
 
-			err = enumTmpl.Execute(out, model)
+			err := enumTmpl.Execute(out, model)
 			checkError(errors.Wrap(err, "enumTmpl"))
 		}
 	}
@@ -373,3 +632,251 @@ func callMethod(out *os.File, h *handlerTmplModel) {
 	err := callMethodTmpl.Execute(out, h)
 	checkError(errors.Wrap(err, "callMethod"))
 }
+
+var cliTmpl = template.Must(template.New(`cliTmpl`).Parse(`// Code generated by handlers_gen. DO NOT EDIT.
+
+// {{.Name}} is a command line client for {{.StructName}}.
+//
+// Usage:
+//
+//	{{.Name}} [-addr http://localhost:8080] [-auth 100500] [-idempotency-key key] <command> [flags]
+//
+// The unwrapped response is printed to stdout, the error to stderr.
+// The idempotency key is sent only to idempotent methods, so a retry with the same key isn't run twice.
+// Exit code is 0 for 2xx responses, 4 for 4xx, 5 for 5xx, 2 for invalid usage and 1 for other errors.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+{{- if .HasIntFlags}}
+	"strconv"
+{{- end}}
+	"strings"
+)
+
+type command struct {
+	name       string
+	url        string
+	method     string
+	auth       bool
+	idempotent bool
+	parse      func(args []string, output io.Writer) (url.Values, error)
+}
+
+var commands = []command{
+{{- range .Commands}}
+	{name: "{{.Name}}", url: "{{.URL}}", method: "{{.Method}}", auth: {{.IsProtected}}, idempotent: {{.IsIdempotent}}, parse: parse{{.FuncName}}},
+{{- end}}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run is the whole client, it returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("{{.Name}}", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	addr := fs.String("addr", "http://localhost:8080", "api address")
+	auth := fs.String("auth", "", "X-Auth header value for protected methods")
+	idempotencyKey := fs.String("idempotency-key", "", "Idempotency-Key header value for idempotent methods")
+	fs.Usage = func() {
+		usage(fs)
+	}
+
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+
+	cmd, cmdArgs, ok := findCommand(fs.Args())
+	if !ok {
+		usage(fs)
+		return 2
+	}
+
+	params, err := cmd.parse(cmdArgs, stderr)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	code, err := call(stdout, *addr, *auth, *idempotencyKey, cmd, params)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+	}
+	return code
+}
+
+func usage(fs *flag.FlagSet) {
+	fmt.Fprintf(fs.Output(), "Usage: %s [flags] <command> [command flags]\n\nFlags:\n", fs.Name())
+	fs.PrintDefaults()
+	fmt.Fprintln(fs.Output(), "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(fs.Output(), "  %s\n", cmd.name)
+	}
+}
+
+func findCommand(args []string) (*command, []string, bool) {
+	for i, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == cmd.name {
+			return &commands[i], args[len(words):], true
+		}
+	}
+
+	return nil, nil, false
+}
+
+func call(stdout io.Writer, addr, auth, idempotencyKey string, cmd *command, params url.Values) (int, error) {
+	var req *http.Request
+	var err error
+	if cmd.method == http.MethodPost {
+		req, err = http.NewRequest(http.MethodPost, addr+cmd.url, strings.NewReader(params.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		req, err = http.NewRequest(http.MethodGet, addr+cmd.url+"?"+params.Encode(), nil)
+	}
+	if err != nil {
+		return 1, err
+	}
+
+	if cmd.auth {
+		req.Header.Set("X-Auth", auth)
+	}
+
+	if cmd.idempotent && idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 1, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 1, err
+	}
+
+	result := struct {
+		Error    string          ` + "`json:\"error\"`" + `
+		Response json.RawMessage ` + "`json:\"response\"`" + `
+	}{}
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		return 1, fmt.Errorf("can't unpack response %q: %v", body, err)
+	}
+
+	if len(result.Response) != 0 {
+		fmt.Fprintln(stdout, string(result.Response))
+	}
+
+	if result.Error != "" {
+		err = fmt.Errorf("%s", result.Error)
+	}
+
+	return exitCode(resp.StatusCode), err
+}
+
+func exitCode(status int) int {
+	switch {
+	case status >= 200 && status < 300:
+		return 0
+	case status >= 400 && status < 500:
+		return 4
+	case status >= 500:
+		return 5
+	default:
+		return 1
+	}
+}
+{{range .Commands}}
+func parse{{.FuncName}}(args []string, output io.Writer) (url.Values, error) {
+	fs := flag.NewFlagSet("{{.Name}}", flag.ContinueOnError)
+	fs.SetOutput(output)
+	{{- range .Flags}}
+	{{.VarName}} := fs.String("{{.ParamName}}", "{{.Default}}", "{{.Usage}}")
+	{{- end}}
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	{{- range .Flags}}
+{{template "cliValidateTmpl" .}}
+	{{- end}}
+
+	return params, nil
+}
+{{end -}}
+
+{{define "cliValidateTmpl" -}}
+{{- if .Required}}
+	if *{{.VarName}} == "" {
+		return nil, fmt.Errorf("{{.ParamName}} must me not empty")
+	}
+{{- end}}
+{{- if eq .Type "int"}}
+	{{.VarName}}Int, err := strconv.Atoi(*{{.VarName}})
+	if err != nil {
+		return nil, fmt.Errorf("{{.ParamName}} must be int")
+	}
+	{{- if .Default}}
+	if {{.VarName}}Int == 0 {
+		{{.VarName}}Int = {{.Default}}
+	}
+	{{- end}}
+	{{- if .Min}}
+	if {{.VarName}}Int < {{.Min}} {
+		return nil, fmt.Errorf("{{.ParamName}} must be >= {{.Min}}")
+	}
+	{{- end}}
+	{{- if .Max}}
+	if {{.VarName}}Int > {{.Max}} {
+		return nil, fmt.Errorf("{{.ParamName}} must be <= {{.Max}}")
+	}
+	{{- end}}
+	params.Set("{{.ParamName}}", strconv.Itoa({{.VarName}}Int))
+{{- else}}
+	{{- if .Default}}
+	if *{{.VarName}} == "" {
+		*{{.VarName}} = "{{.Default}}"
+	}
+	{{- end}}
+	{{- if .Min}}
+	if len(*{{.VarName}}) < {{.Min}} {
+		return nil, fmt.Errorf("{{.ParamName}} len must be >= {{.Min}}")
+	}
+	{{- end}}
+	{{- if .Max}}
+	if len(*{{.VarName}}) > {{.Max}} {
+		return nil, fmt.Errorf("{{.ParamName}} len must be <= {{.Max}}")
+	}
+	{{- end}}
+	{{- if .Enum}}
+	{{.VarName}}Enum := map[string]bool{ {{- range $i, $v := .Enum}}{{if $i}}, {{end}}"{{$v}}": true{{end -}} }
+	if !{{.VarName}}Enum[*{{.VarName}}] {
+		return nil, fmt.Errorf("{{.ParamName}} must be one of [{{range $i, $v := .Enum}}{{if $i}}, {{end}}{{$v}}{{end}}]")
+	}
+	{{- end}}
+	params.Set("{{.ParamName}}", *{{.VarName}})
+{{- end}}
+{{- end}}`))
@@ -249,40 +249,300 @@ func TestMyApi(t *testing.T) {
 	runTests(t, ts, cases)
 }
 
-// func TestOtherApi(t *testing.T) {
-// 	ts := httptest.NewServer(NewOtherApi())
-
-// 	cases := []Case{
-// 		Case{
-// 			Path:   ApiUserCreate,
-// 			Method: http.MethodPost,
-// 			Query:  "username=I3apBap&level=1&class=barbarian&account_name=Vasily",
-// 			Status: http.StatusBadRequest,
-// 			Auth:   true,
-// 			Result: CR{
-// 				"error": "class must be one of [warrior, sorcerer, rouge]",
-// 			},
-// 		},
-// 		Case{
-// 			Path:   ApiUserCreate,
-// 			Method: http.MethodPost,
-// 			Query:  "username=I3apBap&level=1&class=warrior&account_name=Vasily",
-// 			Status: http.StatusOK,
-// 			Auth:   true,
-// 			Result: CR{
-// 				"error": "",
-// 				"response": CR{
-// 					"id":        12,
-// 					"login":     "I3apBap",
-// 					"full_name": "Vasily",
-// 					"level":     1,
-// 				},
-// 			},
-// 		},
-// 	}
-
-// 	runTests(t, ts, cases)
-// }
+// idempotentCreate posts to /user/create with the Idempotency-Key
+func idempotentCreate(t *testing.T, ts *httptest.Server, key, query string) (int, string) {
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+ApiUserCreate, strings.NewReader(query))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("X-Auth", "100500")
+	req.Header.Add("Idempotency-Key", key)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Errorf("request error: %v", err)
+		return 0, ""
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	return resp.StatusCode, string(body)
+}
+
+func TestMyApiIdempotency(t *testing.T) {
+	DefaultIdempotencyStore = NewMemoryIdempotencyStore(time.Hour)
+	ts := httptest.NewServer(NewMyApi())
+
+	doRequest := func(key, query string) (int, string) {
+		return idempotentCreate(t, ts, key, query)
+	}
+
+	query := "login=idempotent_user&age=32&full_name=Ivan_Ivanov"
+
+	status, first := doRequest("key-1", query)
+	if status != http.StatusOK {
+		t.Fatalf("expected http status %v, got %v: %s", http.StatusOK, status, first)
+	}
+
+	// the user already exists, but the first response is replayed instead of 409
+	status, retry := doRequest("key-1", query)
+	if status != http.StatusOK || retry != first {
+		t.Errorf("expected replayed response %s, got %v %s", first, status, retry)
+	}
+
+	status, body := doRequest("key-1", "login=other_idempotent&age=32")
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("expected http status %v, got %v: %s", http.StatusUnprocessableEntity, status, body)
+	}
+
+	status, body = doRequest("key-2", query)
+	if status != http.StatusConflict {
+		t.Errorf("expected http status %v, got %v: %s", http.StatusConflict, status, body)
+	}
+
+	// the method didn't run, so the fixed request isn't answered with the stale 400
+	status, body = doRequest("key-3", "login=short&age=32")
+	if status != http.StatusBadRequest {
+		t.Errorf("expected http status %v, got %v: %s", http.StatusBadRequest, status, body)
+	}
+
+	status, body = doRequest("key-3", "login=fixed_idempotent&age=32")
+	if status != http.StatusOK {
+		t.Errorf("expected http status %v, got %v: %s", http.StatusOK, status, body)
+	}
+}
+
+func TestMyApiIdempotencyInFlight(t *testing.T) {
+	DefaultIdempotencyStore = NewMemoryIdempotencyStore(time.Hour)
+	api := NewMyApi()
+	ts := httptest.NewServer(api)
+	query := "login=in_flight_user&age=32"
+
+	// the first request holds the key until Create gets the lock
+	api.mu.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		idempotentCreate(t, ts, "in-flight", query)
+	}()
+
+	// Create times out in 500ms, the key is reserved long before that
+	time.Sleep(100 * time.Millisecond)
+	status, body := idempotentCreate(t, ts, "in-flight", query)
+	api.mu.Unlock()
+	<-done
+
+	expected := `{"error":"request with this idempotency key is in progress"}`
+	if status != http.StatusConflict || body != expected {
+		t.Errorf("expected http status %v %s, got %v %s", http.StatusConflict, expected, status, body)
+	}
+}
+
+func TestMyApiTimeout(t *testing.T) {
+	api := NewMyApi()
+	ts := httptest.NewServer(api)
+
+	// Create waits for the lock until the deadline is exceeded
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+ApiUserCreate, strings.NewReader("login=slow_moderator&age=32"))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("X-Auth", "100500")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("expected http status %v, got %v", http.StatusGatewayTimeout, resp.StatusCode)
+	}
+
+	expected := `{"error":"context deadline exceeded"}`
+	if string(body) != expected {
+		t.Errorf("results not match\nGot: %s\nExpected: %s", body, expected)
+	}
+}
+
+func TestMyApiTimeoutIdempotency(t *testing.T) {
+	DefaultIdempotencyStore = NewMemoryIdempotencyStore(time.Hour)
+	api := NewMyApi()
+	ts := httptest.NewServer(api)
+	query := "login=slow_idempotent&age=32"
+
+	api.mu.Lock()
+	status, body := idempotentCreate(t, ts, "slow", query)
+	if status != http.StatusGatewayTimeout {
+		t.Errorf("expected http status %v, got %v: %s", http.StatusGatewayTimeout, status, body)
+	}
+
+	// the abandoned method still runs, the key is kept for it
+	status, body = idempotentCreate(t, ts, "slow", query)
+	if status != http.StatusConflict {
+		t.Errorf("expected http status %v, got %v: %s", http.StatusConflict, status, body)
+	}
+	api.mu.Unlock()
+
+	// the retry gets the result of the abandoned method instead of running it again
+	for i := 0; i < 100; i++ {
+		status, body = idempotentCreate(t, ts, "slow", query)
+		if status != http.StatusConflict {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	expected := `{"error":"","response":{"id":43}}`
+	if status != http.StatusOK || body != expected {
+		t.Errorf("expected http status %v %s, got %v %s", http.StatusOK, expected, status, body)
+	}
+}
+
+func TestVersionedApi(t *testing.T) {
+	ts := httptest.NewServer(NewVersionedApi())
+
+	success := CR{
+		"error": "",
+		"response": CR{
+			"id":        12,
+			"login":     "I3apBap",
+			"full_name": "Vasily",
+			"level":     1,
+		},
+	}
+
+	cases := []Case{
+		Case{ // auth is inherited from the service config
+			Path:   "/v1" + ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "username=I3apBap&level=1&class=warrior&account_name=Vasily",
+			Status: http.StatusForbidden,
+			Result: CR{
+				"error": "unauthorized",
+			},
+		},
+		Case{
+			Path:   "/v1" + ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "username=I3apBap&level=1&class=warrior&account_name=Vasily",
+			Status: http.StatusOK,
+			Auth:   true,
+			Result: success,
+		},
+		Case{
+			Path:   "/v2" + ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "username=I3apBap&level=1&class=warrior&account_name=Vasily",
+			Status: http.StatusOK,
+			Auth:   true,
+			Result: success,
+		},
+		Case{ // only versioned URLs are mounted
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "username=I3apBap&level=1&class=warrior&account_name=Vasily",
+			Status: http.StatusNotFound,
+			Auth:   true,
+			Result: CR{
+				"error": "unknown method",
+			},
+		},
+	}
+
+	runTests(t, ts, cases)
+}
+
+func TestVersionedApiEnums(t *testing.T) {
+	ts := httptest.NewServer(NewVersionedApi())
+
+	cases := []Case{
+		Case{ // both enums get their defaults
+			Path:   "/v1/user/equip",
+			Method: http.MethodPost,
+			Status: http.StatusOK,
+			Auth:   true,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"class": "warrior",
+					"slot":  "head",
+				},
+			},
+		},
+		Case{
+			Path:   "/v1/user/equip",
+			Method: http.MethodPost,
+			Query:  "class=sorcerer&item_slot=feet",
+			Status: http.StatusOK,
+			Auth:   true,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"class": "sorcerer",
+					"slot":  "feet",
+				},
+			},
+		},
+		Case{ // a value of the other enum
+			Path:   "/v1/user/equip",
+			Method: http.MethodPost,
+			Query:  "class=hands&item_slot=feet",
+			Status: http.StatusBadRequest,
+			Auth:   true,
+			Result: CR{
+				"error": "class must be one of [warrior, sorcerer, rouge]",
+			},
+		},
+		Case{
+			Path:   "/v1/user/equip",
+			Method: http.MethodPost,
+			Query:  "class=rouge&item_slot=warrior",
+			Status: http.StatusBadRequest,
+			Auth:   true,
+			Result: CR{
+				"error": "item_slot must be one of [head, hands, feet]",
+			},
+		},
+	}
+
+	runTests(t, ts, cases)
+}
+
+func TestOtherApi(t *testing.T) {
+	ts := httptest.NewServer(NewOtherApi())
+
+	cases := []Case{
+		Case{
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "username=I3apBap&level=1&class=barbarian&account_name=Vasily",
+			Status: http.StatusBadRequest,
+			Auth:   true,
+			Result: CR{
+				"error": "class must be one of [warrior, sorcerer, rouge]",
+			},
+		},
+		Case{
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "username=I3apBap&level=1&class=warrior&account_name=Vasily",
+			Status: http.StatusOK,
+			Auth:   true,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        12,
+					"login":     "I3apBap",
+					"full_name": "Vasily",
+					"level":     1,
+				},
+			},
+		},
+	}
+
+	runTests(t, ts, cases)
+}
 
 func runTests(t *testing.T, ts *httptest.Server, cases []Case) {
 	for idx, item := range cases {
@@ -3,8 +3,9 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
-	"strconv"
+	"net/url"
 	"strings"
 )
 
@@ -15,6 +16,10 @@ func declareRoutes(exp *dBExplorer) {
 	exp.router.RegisterRoute("PUT", 1, exp.createRecord)
 	exp.router.RegisterRoute("POST", 2, exp.updateRecord)
 	exp.router.RegisterRoute("DELETE", 2, exp.deleteRecord)
+	exp.router.RegisterNamedRoute("GET", 2, "_schema", exp.getTableSchema)
+	exp.router.RegisterNamedRoute("POST", 1, "_reload", exp.reloadTables)
+	exp.router.RegisterNamedRoute("POST", 2, "_bulk", exp.bulkRecords)
+	exp.router.RegisterNamedRoute("POST", 2, "_import", exp.importRecords)
 }
 
 func (exp *dBExplorer) getAllTables(w http.ResponseWriter, r *http.Request) {
@@ -23,25 +28,8 @@ func (exp *dBExplorer) getAllTables(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := exp.db.Query("SHOW TABLES")
-	if err != nil {
-		writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
-	}
-
-	resp := make([]string, 0)
-
-	for rows.Next() {
-		var tableName string
-
-		err = rows.Scan(&tableName)
-		if err != nil {
-			writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
-		}
-
-		resp = append(resp, tableName)
-	}
-
-	writeResponseJSON(w, http.StatusOK, "tables", resp, "")
+	// the loaded schema, not the database, so only tables the other endpoints know are listed
+	writeResponseJSON(w, http.StatusOK, "tables", exp.tableNames(), "")
 }
 
 func (exp *dBExplorer) getRecordsFromTable(w http.ResponseWriter, r *http.Request) {
@@ -51,57 +39,65 @@ func (exp *dBExplorer) getRecordsFromTable(w http.ResponseWriter, r *http.Reques
 	}
 
 	tableName := strings.Trim(r.URL.Path, "/")
-	table, ok := exp.tables[tableName]
+	table, ok := exp.table(tableName)
 	if !ok {
 		writeResponseJSON(w, http.StatusNotFound, "", nil, "unknown table")
 		return
 	}
 
-	limit, err := strconv.ParseInt(r.URL.Query().Get("limit"), 0, 32)
+	q, err := parseListQuery(r.URL.Query(), table, exp.dialect)
 	if err != nil {
-		limit = 5
+		writeResponseJSON(w, http.StatusBadRequest, "", nil, err.Error())
+		return
 	}
 
-	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 0, 32)
-	if err != nil {
-		offset = 0
+	if q.format != "" {
+		exp.exportRecords(w, q, table)
+		return
 	}
 
-	resp, err := exp.getAll(limit, offset, table)
+	resp, next, err := exp.getAll(q, table)
 	if err != nil {
 		writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
 		return
 	}
 
-	writeResponseJSON(w, http.StatusOK, "records", resp, "")
-}
-
-func (exp *dBExplorer) getRecordByID(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		writeResponseJSON(w, http.StatusMethodNotAllowed, "", nil, "bad method")
+	if !q.cursor && !q.count {
+		writeResponseJSON(w, http.StatusOK, "records", resp, "")
 		return
 	}
 
-	params := strings.Split(r.URL.Path, "/")
-	if len(params) != 3 {
-		writeResponseJSON(w, http.StatusBadRequest, "", nil, "invalid URL")
-		return
+	fields := map[string]interface{}{"records": resp}
+	if q.cursor {
+		// null on the last page
+		fields["next_cursor"] = nil
+		if next != "" {
+			fields["next_cursor"] = next
+		}
+	}
+	if q.count {
+		fields["total"], err = exp.count(q, table)
+		if err != nil {
+			writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
+			return
+		}
 	}
 
-	tableName := params[1]
-	id, err := strconv.Atoi(params[2])
-	if err != nil {
-		writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
+	writeResponseFieldsJSON(w, http.StatusOK, fields)
+}
+
+func (exp *dBExplorer) getRecordByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeResponseJSON(w, http.StatusMethodNotAllowed, "", nil, "bad method")
 		return
 	}
 
-	table, ok := exp.tables[tableName]
+	table, key, ok := exp.parseRecordURL(w, r)
 	if !ok {
-		writeResponseJSON(w, http.StatusNotFound, "", nil, fmt.Sprintf("table %s doesn't exist", tableName))
 		return
 	}
 
-	resp, err := exp.getByID(id, table)
+	resp, err := exp.getByKey(key, table)
 	if err != nil {
 		writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
 		return
@@ -122,26 +118,32 @@ func (exp *dBExplorer) createRecord(w http.ResponseWriter, r *http.Request) {
 	}
 
 	tableName := strings.Trim(r.URL.Path, "/")
-	table, ok := exp.tables[tableName]
+	table, ok := exp.table(tableName)
 	if !ok {
 		writeResponseJSON(w, http.StatusNotFound, "", nil, fmt.Sprintf("table %s doesn't exist", tableName))
 		return
 	}
 
 	data := make(map[string]interface{})
-	err := json.NewDecoder(r.Body).Decode(&data)
+	err := decodeJSON(r.Body, &data)
 	if err != nil {
 		writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
 		return
 	}
 
-	lastID, err := exp.insert(data, table.columns, tableName)
+	err = validateFields(data, table)
+	if err != nil {
+		writeResponseJSON(w, http.StatusBadRequest, "", nil, err.Error())
+		return
+	}
+
+	key, err := exp.insert(exp.db, data, table, false)
 	if err != nil {
 		writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
 		return
 	}
 
-	writeResponseJSON(w, http.StatusOK, table.columns[0].field, lastID, "")
+	writeResponseFieldsJSON(w, http.StatusOK, key)
 }
 
 func (exp *dBExplorer) deleteRecord(w http.ResponseWriter, r *http.Request) {
@@ -150,26 +152,12 @@ func (exp *dBExplorer) deleteRecord(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	params := strings.Split(r.URL.Path, "/")
-	if len(params) != 3 {
-		writeResponseJSON(w, http.StatusBadRequest, "", nil, "invalid URL")
-		return
-	}
-
-	tableName := params[1]
-	id, err := strconv.Atoi(params[2])
-	if err != nil {
-		writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
-		return
-	}
-
-	table, ok := exp.tables[tableName]
+	table, key, ok := exp.parseRecordURL(w, r)
 	if !ok {
-		writeResponseJSON(w, http.StatusNotFound, "", nil, fmt.Sprintf("table %s doesn't exist", tableName))
 		return
 	}
 
-	rowsAffected, err := exp.delete(id, table)
+	rowsAffected, err := exp.delete(exp.db, key, table)
 	if err != nil {
 		writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
 		return
@@ -184,43 +172,99 @@ func (exp *dBExplorer) updateRecord(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	params := strings.Split(r.URL.Path, "/")
-	if len(params) != 3 {
-		writeResponseJSON(w, http.StatusBadRequest, "", nil, "invalid URL")
+	table, key, ok := exp.parseRecordURL(w, r)
+	if !ok {
 		return
 	}
 
-	tableName := params[1]
-	id, err := strconv.Atoi(params[2])
+	data := make(map[string]interface{})
+	err := decodeJSON(r.Body, &data)
 	if err != nil {
 		writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
 		return
 	}
 
-	table, ok := exp.tables[tableName]
-	if !ok {
-		writeResponseJSON(w, http.StatusNotFound, "", nil, fmt.Sprintf("table %s doesn't exist", tableName))
+	err = validateUpdate(data, table)
+	if err != nil {
+		writeResponseJSON(w, http.StatusBadRequest, "", nil, err.Error())
 		return
 	}
 
-	data := make(map[string]interface{})
-	err = json.NewDecoder(r.Body).Decode(&data)
+	rowsAffected, err := exp.update(exp.db, key, data, table)
 	if err != nil {
 		writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
 		return
 	}
 
-	err = validateFields(data, table)
+	writeResponseJSON(w, http.StatusOK, "updated", rowsAffected, "")
+}
+
+// decodeJSON keeps numbers as json.Number, big integers don't fit float64
+func decodeJSON(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// parseTableURL finds the table in /$table/_action, e.g. /$table/_schema.
+// The error response is written if the URL is wrong.
+func (exp *dBExplorer) parseTableURL(w http.ResponseWriter, r *http.Request) (*tableInfo, bool) {
+	params := strings.Split(r.URL.EscapedPath(), "/")
+	if len(params) != 3 {
+		writeResponseJSON(w, http.StatusBadRequest, "", nil, "invalid URL")
+		return nil, false
+	}
+
+	tableName, err := url.PathUnescape(params[1])
 	if err != nil {
-		writeResponseJSON(w, http.StatusBadRequest, "", nil, err.Error())
-		return
+		writeResponseJSON(w, http.StatusBadRequest, "", nil, "invalid URL")
+		return nil, false
 	}
 
-	rowsAffected, err := exp.update(id, data, table.columns, tableName)
+	table, ok := exp.table(tableName)
+	if !ok {
+		writeResponseJSON(w, http.StatusNotFound, "", nil, fmt.Sprintf("table %s doesn't exist", tableName))
+		return nil, false
+	}
+
+	return table, true
+}
+
+// parseRecordURL finds the table and the primary key of the record in /$table/$key.
+// Values of composite keys are separated by commas, commas inside values are escaped as %2C.
+// The error response is written if the URL is wrong.
+func (exp *dBExplorer) parseRecordURL(w http.ResponseWriter, r *http.Request) (*tableInfo, []interface{}, bool) {
+	params := strings.Split(r.URL.EscapedPath(), "/")
+	if len(params) != 3 {
+		writeResponseJSON(w, http.StatusBadRequest, "", nil, "invalid URL")
+		return nil, nil, false
+	}
+
+	tableName, err := url.PathUnescape(params[1])
 	if err != nil {
-		writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
-		return
+		writeResponseJSON(w, http.StatusBadRequest, "", nil, "invalid URL")
+		return nil, nil, false
 	}
 
-	writeResponseJSON(w, http.StatusOK, "updated", rowsAffected, "")
+	table, ok := exp.table(tableName)
+	if !ok {
+		writeResponseJSON(w, http.StatusNotFound, "", nil, fmt.Sprintf("table %s doesn't exist", tableName))
+		return nil, nil, false
+	}
+
+	rawValues := strings.Split(params[2], ",")
+	for i := range rawValues {
+		if rawValues[i], err = url.PathUnescape(rawValues[i]); err != nil {
+			writeResponseJSON(w, http.StatusBadRequest, "", nil, "invalid URL")
+			return nil, nil, false
+		}
+	}
+
+	key, err := parseKey(table, rawValues, exp.dialect)
+	if err != nil {
+		writeResponseJSON(w, http.StatusBadRequest, "", nil, err.Error())
+		return nil, nil, false
+	}
+
+	return table, key, true
 }
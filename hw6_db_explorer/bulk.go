@@ -0,0 +1,191 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+)
+
+// maxBulkOps limits one request, bigger imports are split by the client
+const maxBulkOps = 10000
+
+const (
+	// bulkAllOrNothing rolls back everything on the first failed op
+	bulkAllOrNothing = "all_or_nothing"
+	// bulkBestEffort skips failed ops and commits the rest
+	bulkBestEffort = "best_effort"
+)
+
+type bulkRequest struct {
+	Mode string   `json:"mode"`
+	Ops  []bulkOp `json:"ops"`
+}
+
+// bulkOp is one of
+// {"op": "create", "record": {...}}, {"op": "update", "key": {...}, "record": {...}}, {"op": "delete", "key": {...}},
+// key holds all columns of the primary key
+type bulkOp struct {
+	Op     string                 `json:"op"`
+	Key    map[string]interface{} `json:"key"`
+	Record map[string]interface{} `json:"record"`
+	// keepKeys inserts values of auto increment columns from the record, imports keep keys of exported records
+	keepKeys bool
+}
+
+type bulkResult struct {
+	Op      string                 `json:"op"`
+	Status  int                    `json:"status"`
+	Key     map[string]interface{} `json:"key,omitempty"`
+	Updated *int64                 `json:"updated,omitempty"`
+	Deleted *int64                 `json:"deleted,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// bulkRecords is POST /$table/_bulk, all ops run in one transaction
+func (exp *dBExplorer) bulkRecords(w http.ResponseWriter, r *http.Request) {
+	table, ok := exp.parseTableURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req bulkRequest
+	err := decodeJSON(r.Body, &req)
+	if err != nil {
+		writeResponseJSON(w, http.StatusBadRequest, "", nil, err.Error())
+		return
+	}
+
+	switch req.Mode {
+	case "":
+		req.Mode = bulkAllOrNothing
+	case bulkAllOrNothing, bulkBestEffort:
+	default:
+		writeResponseJSON(w, http.StatusBadRequest, "", nil, fmt.Sprintf("unknown mode %s", req.Mode))
+		return
+	}
+	if len(req.Ops) > maxBulkOps {
+		writeResponseJSON(w, http.StatusBadRequest, "", nil, fmt.Sprintf("too many ops, max %d", maxBulkOps))
+		return
+	}
+
+	tx, err := exp.db.Begin()
+	if err != nil {
+		writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	results := make([]bulkResult, 0, len(req.Ops))
+	for i, op := range req.Ops {
+		res, err := exp.bulkOp(tx, table, op, req.Mode == bulkBestEffort)
+		if err != nil {
+			writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
+			return
+		}
+		results = append(results, res)
+
+		if res.Error != "" && req.Mode == bulkAllOrNothing {
+			writeErrorFieldsJSON(w, res.Status, fmt.Sprintf("op %d: %s", i, res.Error),
+				map[string]interface{}{"committed": false, "results": results})
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
+		return
+	}
+
+	writeResponseFieldsJSON(w, http.StatusOK, map[string]interface{}{"committed": true, "results": results})
+}
+
+// bulkOp runs one op, its failure is returned in the result. The error is returned
+// only if the transaction can't go on. With savepoint a failed statement is rolled back alone,
+// otherwise PostgreSQL would refuse to run the rest of the transaction.
+func (exp *dBExplorer) bulkOp(tx *sql.Tx, table *tableInfo, op bulkOp, savepoint bool) (bulkResult, error) {
+	res := bulkResult{Op: op.Op, Status: http.StatusOK}
+
+	var key []interface{}
+	var err error
+	switch op.Op {
+	case "create":
+		err = validateFields(op.Record, table)
+	case "update":
+		if key, err = keyFromFields(table, op.Key, exp.dialect); err == nil {
+			err = validateUpdate(op.Record, table)
+		}
+	case "delete":
+		key, err = keyFromFields(table, op.Key, exp.dialect)
+	default:
+		err = fmt.Errorf("unknown op %s", op.Op)
+	}
+	if err != nil {
+		res.Status = http.StatusBadRequest
+		res.Error = err.Error()
+		return res, nil
+	}
+
+	if savepoint {
+		if _, err = tx.Exec("SAVEPOINT bulk_op"); err != nil {
+			return res, err
+		}
+	}
+
+	switch op.Op {
+	case "create":
+		res.Key, err = exp.insert(tx, op.Record, table, op.keepKeys)
+	case "update":
+		res.Key = op.Key
+		var updated int64
+		updated, err = exp.update(tx, key, op.Record, table)
+		res.Updated = &updated
+	case "delete":
+		res.Key = op.Key
+		var deleted int64
+		deleted, err = exp.delete(tx, key, table)
+		res.Deleted = &deleted
+	}
+
+	if err != nil {
+		res.Status = http.StatusInternalServerError
+		res.Error = err.Error()
+		res.Updated, res.Deleted = nil, nil
+		if savepoint {
+			_, err = tx.Exec("ROLLBACK TO SAVEPOINT bulk_op")
+			return res, err
+		}
+		return res, nil
+	}
+
+	if savepoint {
+		_, err = tx.Exec("RELEASE SAVEPOINT bulk_op")
+	}
+	return res, err
+}
+
+// keyFromFields takes the primary key of the record from the JSON object, the same way parseKey does from the URL
+func keyFromFields(table *tableInfo, fields map[string]interface{}, d dialect) ([]interface{}, error) {
+	if len(table.primaryKey) == 0 {
+		return nil, fmt.Errorf("table %s has no primary key", table.name)
+	}
+
+	key := make([]interface{}, 0, len(table.primaryKey))
+	for _, col := range table.primaryKey {
+		val, ok := fields[col.field]
+		if !ok {
+			return nil, fmt.Errorf("key field %s is missing", col.field)
+		}
+		if val == nil || !compareTypes(col.typeName, val) {
+			return nil, fmt.Errorf("field %s have invalid type", col.field)
+		}
+
+		val, err := dbValue(col, val, d)
+		if err != nil {
+			return nil, fmt.Errorf("field %s have invalid type", col.field)
+		}
+		key = append(key, val)
+	}
+
+	return key, nil
+}
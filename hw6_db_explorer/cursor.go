@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// cursorToken is encoded into next_cursor, clients don't look inside
+type cursorToken struct {
+	Order string        `json:"o"` // the cursor is valid only for the same order
+	After []interface{} `json:"a"`
+}
+
+// orderString describes the order the same way as the sort parameter
+func (q *listQuery) orderString() string {
+	names := make([]string, 0, len(q.order))
+	for _, s := range q.order {
+		if s.desc {
+			names = append(names, "-"+s.column.field)
+		} else {
+			names = append(names, s.column.field)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// parseCursor turns on keyset pagination, an empty cursor is the first page
+func (q *listQuery) parseCursor(raw string, table *tableInfo, d dialect) error {
+	q.cursor = true
+	if len(table.primaryKey) == 0 {
+		return fmt.Errorf("table %s has no primary key, use offset instead of cursor", table.name)
+	}
+	if q.limit <= 0 {
+		return errors.New("limit must be positive with cursor")
+	}
+	// comparisons with null are never true, such records would be lost between pages
+	for _, s := range q.order {
+		if s.column.isNull {
+			return fmt.Errorf("field %s can be null, it can't be sorted with cursor", s.column.field)
+		}
+	}
+	if raw == "" {
+		return nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return errInvalidCursor
+	}
+	token := cursorToken{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(&token); err != nil || token.Order != q.orderString() || len(token.After) != len(q.order) {
+		return errInvalidCursor
+	}
+
+	// values are converted the same way as the ones from the where parameter
+	for i, val := range token.After {
+		raw := ""
+		switch v := val.(type) {
+		case string:
+			raw = v
+		case json.Number:
+			raw = v.String()
+		case bool:
+			raw = strconv.FormatBool(v)
+		default:
+			return errInvalidCursor
+		}
+
+		after, err := parseValue(q.order[i].column, raw, d)
+		if err != nil {
+			return errInvalidCursor
+		}
+		q.after = append(q.after, after)
+	}
+
+	return nil
+}
+
+// nextCursor points after the last record of the page
+func (q *listQuery) nextCursor(last map[string]interface{}) (string, error) {
+	token := cursorToken{Order: q.orderString()}
+	for _, s := range q.order {
+		token.After = append(token.After, last[s.column.field])
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// afterCondition selects records after the cursor in the order of the query:
+// (a > x) OR (a = x AND b > y) OR ..., descending columns use <
+func (exp *dBExplorer) afterCondition(q *listQuery, args *[]interface{}) string {
+	alternatives := make([]string, 0, len(q.order))
+	for i, s := range q.order {
+		conds := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			*args = append(*args, q.after[j])
+			conds = append(conds, fmt.Sprintf("%s = %s", exp.dialect.quote(q.order[j].column.field), exp.dialect.placeholder(len(*args))))
+		}
+
+		op := ">"
+		if s.desc {
+			op = "<"
+		}
+		*args = append(*args, q.after[i])
+		conds = append(conds, fmt.Sprintf("%s %s %s", exp.dialect.quote(s.column.field), op, exp.dialect.placeholder(len(*args))))
+
+		alternatives = append(alternatives, "("+strings.Join(conds, " AND ")+")")
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
@@ -1,97 +1,208 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"errors"
+	"encoding/base64"
+	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"log"
 
 	"fmt"
 
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/AlexeyKremsa/coursera-homework/hw6_db_explorer/router"
 )
 
+// defaultSchemaTimeout limits loading of the schema, a locked table must not hang the start of the server
+const defaultSchemaTimeout = 30 * time.Second
+
 type dBExplorer struct {
-	db     *sql.DB
-	router *router.Router
-	tables map[string]*tableInfo
+	db      *sql.DB
+	dialect dialect
+	router  *router.Router
+
+	// schema holds map[string]*tableInfo, it's replaced as a whole on reload,
+	// so a request works with the same tables from the beginning to the end
+	schema   atomic.Value
+	reloadMu sync.Mutex
+
+	schemaTimeout   time.Duration
+	skipUnreadable  bool
+	refreshCtx      context.Context
+	refreshInterval time.Duration
 }
 
-func newDbExplorer(db *sql.DB) (http.Handler, error) {
-	exp := dBExplorer{db: db, router: router.New(), tables: make(map[string]*tableInfo)}
-	declareRoutes(&exp)
-	exp.loadDBInfo()
+func newDbExplorer(db *sql.DB, options ...option) (http.Handler, error) {
+	d, err := dialectFor(db)
+	if err != nil {
+		return nil, err
+	}
+
+	exp := &dBExplorer{db: db, dialect: d, router: router.New(), schemaTimeout: defaultSchemaTimeout}
+	for _, opt := range options {
+		opt(exp)
+	}
+	declareRoutes(exp)
+
+	tables, skipped, err := exp.loadDBInfo()
+	if err != nil {
+		return nil, fmt.Errorf("load schema: %w", err)
+	}
+	logSkipped(skipped)
+	exp.schema.Store(tables)
+
+	if exp.refreshInterval > 0 {
+		go exp.refreshSchema(exp.refreshCtx, exp.refreshInterval)
+	}
 	return exp.router, nil
 }
 
-func (exp *dBExplorer) loadDBInfo() {
+// tables returns the current schema, it must not be changed
+func (exp *dBExplorer) tables() map[string]*tableInfo {
+	return exp.schema.Load().(map[string]*tableInfo)
+}
+
+// tableNames returns names of the tables of the current schema sorted by name
+func (exp *dBExplorer) tableNames() []string {
+	tables := exp.tables()
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (exp *dBExplorer) table(name string) (*tableInfo, bool) {
+	t, ok := exp.tables()[name]
+	return t, ok
+}
+
+// loadDBInfo reads all tables. With skipUnreadable tables which can't be read are left out
+// and returned in skipped by name, otherwise the first such table fails the whole schema.
+func (exp *dBExplorer) loadDBInfo() (map[string]*tableInfo, map[string]error, error) {
+	ctx := context.Background()
+	if exp.schemaTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, exp.schemaTimeout)
+		defer cancel()
+	}
+
 	// get tables info
-	rows, err := exp.db.Query("SHOW TABLES")
+	tableNames, err := exp.dialect.tables(ctx, exp.db)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, fmt.Errorf("list tables: %w", err)
 	}
 
-	tables := make([]*tableInfo, 0)
-	for rows.Next() {
-		var tableName string
-		err = rows.Scan(&tableName)
+	// get columns info
+	tables := make(map[string]*tableInfo)
+	skipped := make(map[string]error)
+	for _, tableName := range tableNames {
+		t, err := exp.loadTable(ctx, tableName)
 		if err != nil {
-			log.Fatal(err)
+			// a timeout is not a problem of the table, the rest would fail as well
+			if !exp.skipUnreadable || ctx.Err() != nil {
+				return nil, nil, err
+			}
+			skipped[tableName] = err
+			continue
 		}
 
-		t := &tableInfo{
-			name: tableName,
-		}
+		tables[tableName] = t
+	}
+
+	return tables, skipped, nil
+}
 
-		tables = append(tables, t)
+func (exp *dBExplorer) loadTable(ctx context.Context, tableName string) (*tableInfo, error) {
+	columns, err := exp.dialect.columns(ctx, exp.db, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("read columns of table %s: %w", tableName, err)
 	}
 
-	// get columns info
-	for _, t := range tables {
-		rows, err := exp.db.Query(fmt.Sprintf("SHOW COLUMNS FROM `%s`", t.name))
-		if err != nil {
-			log.Fatal(err)
-		}
+	t := newTableInfo(tableName, columns)
+	t.foreignKeys, err = exp.dialect.foreignKeys(ctx, exp.db, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("read foreign keys of table %s: %w", tableName, err)
+	}
+	t.indexes, err = exp.dialect.indexes(ctx, exp.db, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("read indexes of table %s: %w", tableName, err)
+	}
 
-		columns := make([]*columnInfo, 0)
-		for rows.Next() {
-			col := &columnInfo{}
-			// need string here to read value and convert it from string to bool
-			var isNull string
-			err = rows.Scan(&col.field, &col.typeName, &isNull, &col.key, &col.defaultVal, &col.extra)
-			if err != nil {
-				log.Fatal(err)
-			}
+	return t, nil
+}
 
-			if isNull == "YES" {
-				col.isNull = true
-			} else {
-				col.isNull = false
-			}
+func logSkipped(skipped map[string]error) {
+	for _, err := range skipped {
+		log.Printf("table is skipped: %v", err)
+	}
+}
 
-			columns = append(columns, col)
+// baseType drops the size, the sign and the charset from the type name and makes it upper case,
+// e.g. varchar(255) becomes VARCHAR
+func baseType(typeName string) string {
+	typeName = strings.ToUpper(typeName)
+	for _, suffix := range []string{"(", " UNSIGNED", " ZEROFILL", " CHARACTER SET", " COLLATE"} {
+		if i := strings.Index(typeName, suffix); i >= 0 {
+			typeName = typeName[:i]
 		}
-
-		t.columns = append(t.columns, columns...)
-		exp.tables[t.name] = t
 	}
+	return strings.TrimSpace(typeName)
 }
 
-func getVariable(varType string) (interface{}, error) {
-	var varInt int
-	var varString sql.NullString
-	switch varType {
-	case "INT":
-		return &varInt, nil
+// parseKey converts values of the primary key from the URL to the types of the key columns
+func parseKey(table *tableInfo, rawValues []string, d dialect) ([]interface{}, error) {
+	if len(table.primaryKey) == 0 {
+		return nil, fmt.Errorf("table %s has no primary key", table.name)
+	}
+	if len(rawValues) != len(table.primaryKey) {
+		return nil, fmt.Errorf("primary key of table %s has %d columns, got %d values", table.name, len(table.primaryKey), len(rawValues))
+	}
+
+	key := make([]interface{}, 0, len(rawValues))
+	for i, col := range table.primaryKey {
+		val, err := parseValue(col, rawValues[i], d)
+		if err != nil {
+			return nil, err
+		}
+		key = append(key, val)
+	}
 
-	case "VARCHAR", "TEXT":
-		return &varString, nil
+	return key, nil
+}
 
+// getVariable returns a variable to scan the value of the column into
+func getVariable(typeName string) interface{} {
+	switch columnKind(typeName) {
+	case kindInt:
+		return &sql.NullInt64{}
+	case kindUint:
+		return &uintValue{}
+	case kindFloat:
+		return &sql.NullFloat64{}
+	case kindBool:
+		return &sql.NullBool{}
+	case kindDateTime:
+		return &timeValue{}
+	case kindDate:
+		return &timeValue{date: true}
+	case kindJSON:
+		return &jsonValue{}
+	case kindBlob:
+		return &[]byte{}
 	default:
-		return nil, fmt.Errorf("unsupported type: %s", varType)
+		// decimals are strings too, so they don't lose precision
+		return &sql.NullString{}
 	}
 }
 
@@ -100,8 +211,33 @@ func prepareResponse(data []interface{}, colNames []string) (map[string]interfac
 
 	for i := 0; i < len(data); i++ {
 		switch v := data[i].(type) {
-		case *int:
-			resp[colNames[i]] = *v
+		case *sql.NullInt64:
+			if v.Valid {
+				resp[colNames[i]] = v.Int64
+			} else {
+				resp[colNames[i]] = nil
+			}
+
+		case *uintValue:
+			if v.Valid {
+				resp[colNames[i]] = json.Number(v.String)
+			} else {
+				resp[colNames[i]] = nil
+			}
+
+		case *sql.NullFloat64:
+			if v.Valid {
+				resp[colNames[i]] = floatValue(v.Float64)
+			} else {
+				resp[colNames[i]] = nil
+			}
+
+		case *sql.NullBool:
+			if v.Valid {
+				resp[colNames[i]] = v.Bool
+			} else {
+				resp[colNames[i]] = nil
+			}
 
 		case *sql.NullString:
 			if v.Valid {
@@ -110,6 +246,24 @@ func prepareResponse(data []interface{}, colNames []string) (map[string]interfac
 				resp[colNames[i]] = nil
 			}
 
+		case *timeValue:
+			resp[colNames[i]] = v.value()
+
+		case *jsonValue:
+			if v.valid {
+				resp[colNames[i]] = v.raw
+			} else {
+				resp[colNames[i]] = nil
+			}
+
+		// encoding/json writes bytes as base64
+		case *[]byte:
+			if *v != nil {
+				resp[colNames[i]] = *v
+			} else {
+				resp[colNames[i]] = nil
+			}
+
 		default:
 			return nil, fmt.Errorf("unsupported type: %s", reflect.TypeOf(v).String())
 		}
@@ -119,13 +273,6 @@ func prepareResponse(data []interface{}, colNames []string) (map[string]interfac
 }
 
 func validateFields(data map[string]interface{}, table *tableInfo) error {
-	if len(data) == 1 {
-		_, ok := data["id"]
-		if ok {
-			return errors.New("field id have invalid type")
-		}
-	}
-
 	for _, column := range table.columns {
 		val, ok := data[column.field]
 		if !ok {
@@ -133,14 +280,14 @@ func validateFields(data map[string]interface{}, table *tableInfo) error {
 		}
 
 		if val == nil && column.isNull {
-			return nil
+			continue
 		}
 
 		if val == nil && !column.isNull {
 			return fmt.Errorf("field %s have invalid type", column.field)
 		}
 
-		if !compareTypes(column.typeName, reflect.TypeOf(val).Name()) {
+		if !compareTypes(column.typeName, val) {
 			return fmt.Errorf("field %s have invalid type", column.field)
 		}
 	}
@@ -148,16 +295,73 @@ func validateFields(data map[string]interface{}, table *tableInfo) error {
 	return nil
 }
 
-func compareTypes(colType, fieldType string) bool {
-	switch fieldType {
-	case "string":
-		if colType == "varchar(255)" || colType == "text" {
+// validateUpdate also forbids to change the primary key, the record is found by it
+func validateUpdate(data map[string]interface{}, table *tableInfo) error {
+	for _, column := range table.primaryKey {
+		if _, ok := data[column.field]; ok {
+			return fmt.Errorf("field %s have invalid type", column.field)
+		}
+	}
+
+	return validateFields(data, table)
+}
+
+// compareTypes checks that the value decoded from JSON fits the column
+func compareTypes(colType string, val interface{}) bool {
+	switch v := val.(type) {
+	case string:
+		switch columnKind(colType) {
+		case kindString:
+			return enumValues(colType) == nil || contains(enumValues(colType), v)
+		case kindDecimal:
+			_, err := strconv.ParseFloat(v, 64)
+			return err == nil
+		case kindDateTime, kindDate:
+			_, ok := parseTime(v)
+			return ok
+		case kindBlob:
+			_, err := base64.StdEncoding.DecodeString(v)
+			return err == nil
+		case kindJSON:
 			return true
 		}
 
-	default:
-		return false
+	case json.Number:
+		switch columnKind(colType) {
+		case kindInt:
+			_, err := jsonInt(v)
+			return err == nil
+		case kindUint:
+			_, err := jsonUint(v)
+			return err == nil
+		case kindBool:
+			return v.String() == "0" || v.String() == "1"
+		case kindFloat, kindDecimal:
+			_, err := v.Float64()
+			return err == nil
+		case kindJSON:
+			return true
+		}
+
+	case bool:
+		switch columnKind(colType) {
+		case kindBool, kindJSON:
+			return true
+		}
+
+	// objects and arrays
+	case map[string]interface{}, []interface{}:
+		return columnKind(colType) == kindJSON
 	}
 
 	return false
 }
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
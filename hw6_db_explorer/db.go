@@ -1,95 +1,194 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
 	"strings"
 )
 
-func (exp *dBExplorer) executeQuery(query string, colNames []string) ([]map[string]interface{}, error) {
-	rows, err := exp.db.Query(query)
+// queryer is *sql.DB or *sql.Tx, so records can be changed in a transaction as well
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// executeQuery reads the columns from every row, values are converted by the types of the columns
+func (exp *dBExplorer) executeQuery(db queryer, query string, columns []*columnInfo, args ...interface{}) ([]map[string]interface{}, error) {
+	resp := make([]map[string]interface{}, 0)
+	err := exp.streamQuery(db, query, columns, args, func(rowData map[string]interface{}) error {
+		resp = append(resp, rowData)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	colsToRead := make([]interface{}, 0)
-	colTypes, err := rows.ColumnTypes()
+	return resp, nil
+}
+
+// streamQuery passes rows to fn one by one without keeping them, reading stops on the first error of fn
+func (exp *dBExplorer) streamQuery(db queryer, query string, columns []*columnInfo, args []interface{},
+	fn func(rowData map[string]interface{}) error) error {
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer rows.Close()
 
-	for _, item := range colTypes {
+	colsToRead := make([]interface{}, 0, len(columns))
+	colNames := make([]string, 0, len(columns))
+	for _, col := range columns {
 		// we need proper variables to read data
-		col, err := getVariable(item.DatabaseTypeName())
-		if err != nil {
-			return nil, err
-		}
-		colsToRead = append(colsToRead, col)
+		colsToRead = append(colsToRead, getVariable(col.typeName))
+		colNames = append(colNames, col.field)
 	}
 
-	resp := make([]map[string]interface{}, 0)
 	for rows.Next() {
 		err = rows.Scan(colsToRead...)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		rowData, err := prepareResponse(colsToRead, colNames)
 		if err != nil {
-			if err != nil {
-				return nil, err
-			}
+			return err
 		}
 
-		resp = append(resp, rowData)
+		err = fn(rowData)
+		if err != nil {
+			return err
+		}
 	}
 
-	return resp, nil
+	return rows.Err()
+}
+
+// quoteNames quotes column names and joins them with commas
+func (exp *dBExplorer) quoteNames(names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, exp.dialect.quote(name))
+	}
+	return strings.Join(quoted, ", ")
 }
 
-func (exp *dBExplorer) insert(data map[string]interface{}, columns []*columnInfo, tableName string) (int64, error) {
+// placeholders returns n comma separated query parameters, numbering starts from 1
+func (exp *dBExplorer) placeholders(n int) string {
+	res := make([]string, 0, n)
+	for i := 1; i <= n; i++ {
+		res = append(res, exp.dialect.placeholder(i))
+	}
+	return strings.Join(res, ", ")
+}
+
+// keyCondition matches the record by its primary key, numbering of placeholders starts from first
+func (exp *dBExplorer) keyCondition(table *tableInfo, first int) string {
+	conds := make([]string, 0, len(table.primaryKey))
+	for i, col := range table.primaryKey {
+		conds = append(conds, fmt.Sprintf("%s = %s", exp.dialect.quote(col.field), exp.dialect.placeholder(first+i)))
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// insert returns the primary key of the new record. Auto increment columns are filled by the database
+// unless keepKeys is set and the data has them, missing columns get their defaults, empty strings or nulls.
+func (exp *dBExplorer) insert(db queryer, data map[string]interface{}, table *tableInfo, keepKeys bool) (map[string]interface{}, error) {
 	colNames := make([]string, 0)
 	values := make([]interface{}, 0)
+	inserted := make(map[string]interface{})
 
-	// skip 1st element, normally it`s an id
-	for i := 1; i < len(columns); i++ {
-		colNames = append(colNames, columns[i].field)
+	for _, col := range table.columns {
+		if col.isAutoIncrement() && (!keepKeys || data[col.field] == nil) {
+			continue
+		}
 
-		val, ok := data[columns[i].field]
+		val, ok := data[col.field]
 		if !ok {
-			if columns[i].isNull {
+			switch {
+			case col.defaultVal != nil:
+				continue
+			case col.isNull:
 				val = nil
-			} else {
+			default:
 				val = ""
 			}
 		}
 
+		inserted[col.field] = val
+		val, err := dbValue(col, val, exp.dialect)
+		if err != nil {
+			return nil, err
+		}
+
+		colNames = append(colNames, col.field)
 		values = append(values, val)
 	}
 
-	columnsStr := strings.Join(colNames, ", ")
-	placeholders := "?" + strings.Repeat(", ?", len(values)-1)
-	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", tableName, columnsStr, placeholders)
-	res, err := exp.db.Exec(query, values...)
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		exp.dialect.quote(table.name), exp.quoteNames(colNames), exp.placeholders(len(values)))
+
+	keyNames := make([]string, 0, len(table.primaryKey))
+	for _, col := range table.primaryKey {
+		keyNames = append(keyNames, col.field)
+	}
+
+	if exp.dialect.returning() && len(keyNames) > 0 {
+		resp, err := exp.executeQuery(db, query+" RETURNING "+exp.quoteNames(keyNames), table.primaryKey, values...)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp) == 0 {
+			return nil, fmt.Errorf("no record was inserted into %s", table.name)
+		}
+		return resp[0], nil
+	}
+
+	res, err := db.Exec(query, values...)
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
 
-	return res.LastInsertId()
+	key := make(map[string]interface{}, len(table.primaryKey))
+	for _, col := range table.primaryKey {
+		if _, explicit := inserted[col.field]; explicit || !col.isAutoIncrement() {
+			key[col.field] = inserted[col.field]
+			continue
+		}
+
+		id, err := res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		key[col.field] = id
+	}
+
+	return key, nil
 }
 
-func (exp *dBExplorer) update(id int, data map[string]interface{}, columns []*columnInfo, tableName string) (int64, error) {
+func (exp *dBExplorer) update(db queryer, key []interface{}, data map[string]interface{}, table *tableInfo) (int64, error) {
 	setStmts := make([]string, 0)
 	values := make([]interface{}, 0)
 
-	for k, v := range data {
-		setStmts = append(setStmts, fmt.Sprintf("%v = ?", k))
+	// only known columns are updated, the rest is ignored
+	for _, col := range table.columns {
+		v, ok := data[col.field]
+		if !ok {
+			continue
+		}
+		v, err := dbValue(col, v, exp.dialect)
+		if err != nil {
+			return -1, err
+		}
 		values = append(values, v)
+		setStmts = append(setStmts, fmt.Sprintf("%s = %s", exp.dialect.quote(col.field), exp.dialect.placeholder(len(values))))
+	}
+	if len(setStmts) == 0 {
+		return 0, nil
 	}
 
-	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s = %d", tableName, strings.Join(setStmts, ", "), columns[0].field, id)
-	fmt.Println(query)
-	res, err := exp.db.Exec(query, values...)
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", exp.dialect.quote(table.name), strings.Join(setStmts, ", "),
+		exp.keyCondition(table, len(values)+1))
+	res, err := db.Exec(query, append(values, key...)...)
 	if err != nil {
 		return -1, err
 	}
@@ -97,39 +196,60 @@ func (exp *dBExplorer) update(id int, data map[string]interface{}, columns []*co
 	return res.RowsAffected()
 }
 
-func (exp *dBExplorer) getAll(limit, offset int64, table *tableInfo) ([]map[string]interface{}, error) {
-	// select all columns
-	colNames := make([]string, 0)
-	for _, col := range table.columns {
-		colNames = append(colNames, col.field)
+// getAll returns a page of records and, with the cursor, the cursor of the next page if there is one
+func (exp *dBExplorer) getAll(q *listQuery, table *tableInfo) ([]map[string]interface{}, string, error) {
+	columns := q.columns()
+
+	query, args := exp.selectQuery(table, q)
+	resp, err := exp.executeQuery(exp.db, query, columns, args...)
+	if err != nil || !q.cursor {
+		return resp, "", err
 	}
-	columns := strings.Join(colNames, ", ")
 
-	query := fmt.Sprintf(`SELECT %s FROM %s LIMIT %d OFFSET %d`, columns, table.name, limit, offset)
-	resp, err := exp.executeQuery(query, colNames)
+	next := ""
+	if int64(len(resp)) > q.limit {
+		resp = resp[:q.limit]
+		if next, err = q.nextCursor(resp[len(resp)-1]); err != nil {
+			return nil, "", err
+		}
+	}
 
-	return resp, err
+	// columns selected only for the cursor are not returned
+	for _, col := range columns[len(q.fields):] {
+		for _, record := range resp {
+			delete(record, col.field)
+		}
+	}
+
+	return resp, next, nil
+}
+
+func (exp *dBExplorer) count(q *listQuery, table *tableInfo) (int64, error) {
+	query, args := exp.countQuery(table, q)
+
+	var total int64
+	err := exp.db.QueryRow(query, args...).Scan(&total)
+	return total, err
 }
 
-func (exp *dBExplorer) getByID(id int, table *tableInfo) ([]map[string]interface{}, error) {
+func (exp *dBExplorer) getByKey(key []interface{}, table *tableInfo) ([]map[string]interface{}, error) {
 	// select all columns
 	colNames := make([]string, 0)
 	for _, col := range table.columns {
 		colNames = append(colNames, col.field)
 	}
-	columns := strings.Join(colNames, ", ")
 
-	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s = %d`, columns, table.name, table.columns[0].field, id)
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s`, exp.quoteNames(colNames), exp.dialect.quote(table.name), exp.keyCondition(table, 1))
 
-	resp, err := exp.executeQuery(query, colNames)
+	resp, err := exp.executeQuery(exp.db, query, table.columns, key...)
 
 	return resp, err
 }
 
-func (exp *dBExplorer) delete(id int, table *tableInfo) (int64, error) {
-	query := fmt.Sprintf("DELETE FROM %s WHERE %s = ?", table.name, table.columns[0].field)
+func (exp *dBExplorer) delete(db queryer, key []interface{}, table *tableInfo) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s", exp.dialect.quote(table.name), exp.keyCondition(table, 1))
 
-	res, err := exp.db.Exec(query, id)
+	res, err := db.Exec(query, key...)
 	if err != nil {
 		return -1, err
 	}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dialect hides what differs between databases: schema introspection, placeholders,
+// quoting of identifiers and the way to get the id of an inserted record.
+// Introspection takes a context, so loading of the schema can be limited in time.
+type dialect interface {
+	// tables returns names of all tables sorted by name
+	tables(ctx context.Context, db *sql.DB) ([]string, error)
+	// columns describes columns of the table the same way as MySQL's SHOW COLUMNS does
+	columns(ctx context.Context, db *sql.DB, table string) ([]*columnInfo, error)
+	foreignKeys(ctx context.Context, db *sql.DB, table string) ([]*foreignKeyInfo, error)
+	indexes(ctx context.Context, db *sql.DB, table string) ([]*indexInfo, error)
+	// placeholder returns the n-th query parameter, starting from 1
+	placeholder(n int) string
+	quote(ident string) string
+	// returning tells to get the inserted id by INSERT ... RETURNING instead of LastInsertId
+	returning() bool
+	// timeParam converts a date or a time to a query parameter, which compares with stored values
+	timeParam(t time.Time, date bool) interface{}
+	// syncCounter moves the counter of the auto increment column past values inserted explicitly
+	syncCounter(db queryer, table, column string) error
+}
+
+// dialectFor picks the dialect by the driver the db was opened with
+func dialectFor(db *sql.DB) (dialect, error) {
+	switch driverName := fmt.Sprintf("%T", db.Driver()); driverName {
+	case "*mysql.MySQLDriver":
+		return mysqlDialect{}, nil
+	case "*sqlite.Driver", "*sqlite3.SQLiteDriver":
+		return sqliteDialect{}, nil
+	case "*pq.Driver", "*stdlib.Driver":
+		return postgresDialect{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", driverName)
+	}
+}
+
+// queryStrings reads the first column of every row
+func queryStrings(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]string, 0)
+	for rows.Next() {
+		var s string
+		err = rows.Scan(&s)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+
+	return res, rows.Err()
+}
+
+// queryForeignKeys reads rows of name, column, referenced table, referenced column
+// ordered by name and position of the column in the key
+func queryForeignKeys(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]*foreignKeyInfo, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]*foreignKeyInfo, 0)
+	for rows.Next() {
+		var name, column, refTable, refColumn string
+		err = rows.Scan(&name, &column, &refTable, &refColumn)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(keys) == 0 || keys[len(keys)-1].name != name {
+			keys = append(keys, &foreignKeyInfo{name: name, refTable: refTable})
+		}
+		key := keys[len(keys)-1]
+		key.columns = append(key.columns, column)
+		key.refColumns = append(key.refColumns, refColumn)
+	}
+
+	return keys, rows.Err()
+}
+
+// queryIndexes reads rows of name, column, uniqueness ordered by name and position of the column in the index
+func queryIndexes(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]*indexInfo, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	indexes := make([]*indexInfo, 0)
+	for rows.Next() {
+		var name, column string
+		var unique bool
+		err = rows.Scan(&name, &column, &unique)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(indexes) == 0 || indexes[len(indexes)-1].name != name {
+			indexes = append(indexes, &indexInfo{name: name, unique: unique})
+		}
+		index := indexes[len(indexes)-1]
+		index.columns = append(index.columns, column)
+	}
+
+	return indexes, rows.Err()
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) tables(ctx context.Context, db *sql.DB) ([]string, error) {
+	return queryStrings(ctx, db, "SHOW TABLES")
+}
+
+func (d mysqlDialect) columns(ctx context.Context, db *sql.DB, table string) ([]*columnInfo, error) {
+	rows, err := db.QueryContext(ctx, "SHOW COLUMNS FROM "+d.quote(table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make([]*columnInfo, 0)
+	for rows.Next() {
+		col := &columnInfo{}
+		// need string here to read value and convert it from string to bool
+		var isNull string
+		err = rows.Scan(&col.field, &col.typeName, &isNull, &col.key, &col.defaultVal, &col.extra)
+		if err != nil {
+			return nil, err
+		}
+
+		col.isNull = isNull == "YES"
+		columns = append(columns, col)
+	}
+
+	return columns, rows.Err()
+}
+
+func (mysqlDialect) foreignKeys(ctx context.Context, db *sql.DB, table string) ([]*foreignKeyInfo, error) {
+	return queryForeignKeys(ctx, db, `SELECT CONSTRAINT_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+		FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND REFERENCED_TABLE_NAME IS NOT NULL
+		ORDER BY CONSTRAINT_NAME, ORDINAL_POSITION`, table)
+}
+
+func (mysqlDialect) indexes(ctx context.Context, db *sql.DB, table string) ([]*indexInfo, error) {
+	return queryIndexes(ctx, db, `SELECT INDEX_NAME, COLUMN_NAME, NON_UNIQUE = 0
+		FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+		ORDER BY INDEX_NAME, SEQ_IN_INDEX`, table)
+}
+
+func (mysqlDialect) placeholder(n int) string {
+	return "?"
+}
+
+func (mysqlDialect) quote(ident string) string {
+	return "`" + strings.Replace(ident, "`", "``", -1) + "`"
+}
+
+func (mysqlDialect) returning() bool {
+	return false
+}
+
+func (mysqlDialect) timeParam(t time.Time, date bool) interface{} {
+	return t
+}
+
+// AUTO_INCREMENT is raised by explicit values itself
+func (mysqlDialect) syncCounter(db queryer, table, column string) error {
+	return nil
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) tables(ctx context.Context, db *sql.DB) ([]string, error) {
+	return queryStrings(ctx, db, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+}
+
+func (sqliteDialect) columns(ctx context.Context, db *sql.DB, table string) ([]*columnInfo, error) {
+	rows, err := db.QueryContext(ctx, `SELECT name, type, "notnull", dflt_value, pk FROM pragma_table_info(?) ORDER BY cid`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make([]*columnInfo, 0)
+	pkColumns := 0
+	for rows.Next() {
+		col := &columnInfo{}
+		var notNull bool
+		var pk int
+		err = rows.Scan(&col.field, &col.typeName, &notNull, &col.defaultVal, &pk)
+		if err != nil {
+			return nil, err
+		}
+
+		col.isNull = !notNull
+		if pk > 0 {
+			col.key = "PRI"
+			pkColumns++
+		}
+		columns = append(columns, col)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// a single INTEGER PRIMARY KEY is an alias of rowid, it's filled automatically and is never null
+	for _, col := range columns {
+		if pkColumns == 1 && col.key == "PRI" && strings.EqualFold(col.typeName, "INTEGER") {
+			col.extra = "auto_increment"
+			col.isNull = false
+		}
+	}
+
+	return columns, nil
+}
+
+// foreign keys of SQLite have no names, they are numbered; the referenced column is omitted if it's the primary key
+func (sqliteDialect) foreignKeys(ctx context.Context, db *sql.DB, table string) ([]*foreignKeyInfo, error) {
+	return queryForeignKeys(ctx, db, `SELECT 'fk_' || fk.id, fk."from", fk."table",
+			COALESCE(fk."to", (SELECT ti.name FROM pragma_table_info(fk."table") ti WHERE ti.pk = fk.seq + 1))
+		FROM pragma_foreign_key_list(?) fk
+		ORDER BY fk.id, fk.seq`, table)
+}
+
+func (sqliteDialect) indexes(ctx context.Context, db *sql.DB, table string) ([]*indexInfo, error) {
+	return queryIndexes(ctx, db, `SELECT il.name, ii.name, il."unique"
+		FROM pragma_index_list(?) il, pragma_index_info(il.name) ii
+		WHERE ii.name IS NOT NULL
+		ORDER BY il.name, ii.seqno`, table)
+}
+
+func (sqliteDialect) placeholder(n int) string {
+	return "?"
+}
+
+func (sqliteDialect) quote(ident string) string {
+	return `"` + strings.Replace(ident, `"`, `""`, -1) + `"`
+}
+
+func (sqliteDialect) returning() bool {
+	return true
+}
+
+// SQLite has no time type and compares times as text, the driver would store time.Time as Go's
+// "2006-01-02 15:04:05 +0000 UTC", so times are UTC in the format of CURRENT_TIMESTAMP
+func (sqliteDialect) timeParam(t time.Time, date bool) interface{} {
+	if date {
+		return t.Format("2006-01-02")
+	}
+	return t.UTC().Format("2006-01-02 15:04:05.999999999")
+}
+
+// new rowids and AUTOINCREMENT values are always above the biggest one in the table
+func (sqliteDialect) syncCounter(db queryer, table, column string) error {
+	return nil
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) tables(ctx context.Context, db *sql.DB) ([]string, error) {
+	return queryStrings(ctx, db, `SELECT table_name FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' ORDER BY table_name`)
+}
+
+func (d postgresDialect) columns(ctx context.Context, db *sql.DB, table string) ([]*columnInfo, error) {
+	rows, err := db.QueryContext(ctx, `SELECT a.attname, format_type(a.atttypid, a.atttypmod), NOT a.attnotnull,
+			COALESCE(i.indisprimary, false), pg_get_expr(ad.adbin, ad.adrelid),
+			a.attidentity <> '' OR COALESCE(pg_get_expr(ad.adbin, ad.adrelid) LIKE 'nextval(%', false)
+		FROM pg_attribute a
+		LEFT JOIN pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum
+		LEFT JOIN pg_index i ON i.indrelid = a.attrelid AND i.indisprimary AND a.attnum = ANY(i.indkey)
+		WHERE a.attrelid = to_regclass($1) AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum`, d.quote(table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make([]*columnInfo, 0)
+	for rows.Next() {
+		col := &columnInfo{}
+		var isPrimary, isSerial bool
+		err = rows.Scan(&col.field, &col.typeName, &col.isNull, &isPrimary, &col.defaultVal, &isSerial)
+		if err != nil {
+			return nil, err
+		}
+
+		if isPrimary {
+			col.key = "PRI"
+		}
+		if isSerial {
+			col.extra = "auto_increment"
+		}
+		columns = append(columns, col)
+	}
+
+	return columns, rows.Err()
+}
+
+func (d postgresDialect) foreignKeys(ctx context.Context, db *sql.DB, table string) ([]*foreignKeyInfo, error) {
+	return queryForeignKeys(ctx, db, `SELECT c.conname, a.attname, rc.relname, ra.attname
+		FROM pg_constraint c
+		CROSS JOIN LATERAL unnest(c.conkey, c.confkey) WITH ORDINALITY AS k(attnum, refattnum, n)
+		JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+		JOIN pg_class rc ON rc.oid = c.confrelid
+		JOIN pg_attribute ra ON ra.attrelid = c.confrelid AND ra.attnum = k.refattnum
+		WHERE c.contype = 'f' AND c.conrelid = to_regclass($1)
+		ORDER BY c.conname, k.n`, d.quote(table))
+}
+
+// indexes on expressions have no columns, they are skipped
+func (d postgresDialect) indexes(ctx context.Context, db *sql.DB, table string) ([]*indexInfo, error) {
+	return queryIndexes(ctx, db, `SELECT ic.relname, a.attname, i.indisunique
+		FROM pg_index i
+		JOIN pg_class ic ON ic.oid = i.indexrelid
+		CROSS JOIN LATERAL unnest(i.indkey::int2[]) WITH ORDINALITY AS k(attnum, n)
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+		WHERE i.indrelid = to_regclass($1)
+		ORDER BY ic.relname, k.n`, d.quote(table))
+}
+
+func (postgresDialect) placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (postgresDialect) quote(ident string) string {
+	return `"` + strings.Replace(ident, `"`, `""`, -1) + `"`
+}
+
+func (postgresDialect) returning() bool {
+	return true
+}
+
+func (postgresDialect) timeParam(t time.Time, date bool) interface{} {
+	return t
+}
+
+// sequences don't see explicit values, without setval the next insert would get a taken one
+func (d postgresDialect) syncCounter(db queryer, table, column string) error {
+	_, err := db.Exec(fmt.Sprintf("SELECT setval(pg_get_serial_sequence($1, $2), MAX(%s)) FROM %s", d.quote(column), d.quote(table)),
+		d.quote(table), column)
+	return err
+}
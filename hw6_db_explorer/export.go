@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+)
+
+var contentTypes = map[string]string{
+	formatCSV:    "text/csv; charset=utf-8",
+	formatNDJSON: "application/x-ndjson",
+}
+
+// writeTracker tells if anything has been sent, after that the status can't be changed to an error.
+// Headers of the file are set by the first write, so an error before it is sent as usual JSON.
+type writeTracker struct {
+	w       http.ResponseWriter
+	table   string
+	format  string
+	written bool
+}
+
+func (t *writeTracker) Write(p []byte) (int, error) {
+	if !t.written {
+		t.setHeaders()
+	}
+	t.written = true
+	return t.w.Write(p)
+}
+
+func (t *writeTracker) setHeaders() {
+	t.w.Header().Set("Content-Type", contentTypes[t.format])
+	t.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", t.table+"."+t.format))
+}
+
+// exportRecords streams records of GET /$table?format=csv|ndjson, rows are written as they are read.
+// CSV has a header with names of the columns, NULL is written as ?null=, an empty value by default.
+func (exp *dBExplorer) exportRecords(w http.ResponseWriter, q *listQuery, table *tableInfo) {
+	out := &writeTracker{w: w, table: table.name, format: q.format}
+
+	var write func(rowData map[string]interface{}) error
+	flush := func() error { return nil }
+
+	switch q.format {
+	case formatCSV:
+		cw := csv.NewWriter(out)
+		header := make([]string, 0, len(q.fields))
+		for _, col := range q.fields {
+			header = append(header, col.field)
+		}
+		// it's buffered, nothing is sent until the first rows
+		cw.Write(header)
+
+		write = func(rowData map[string]interface{}) error {
+			row := make([]string, 0, len(header))
+			for _, name := range header {
+				row = append(row, csvValue(rowData[name], q.null))
+			}
+			return cw.Write(row)
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+
+	case formatNDJSON:
+		enc := json.NewEncoder(out)
+		write = func(rowData map[string]interface{}) error {
+			return enc.Encode(rowData)
+		}
+	}
+
+	query, args := exp.selectQuery(table, q)
+	err := exp.streamQuery(exp.db, query, q.fields, args, write)
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		if !out.written {
+			writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
+			return
+		}
+		// the client gets a cut file, there is no way to tell it more
+		log.Printf("export of table %s failed: %v", table.name, err)
+		return
+	}
+
+	// an empty NDJSON file has no writes
+	if !out.written {
+		out.setHeaders()
+	}
+}
+
+// csvValue writes values the same way they look in JSON, blobs are base64
+func csvValue(val interface{}, null string) string {
+	switch v := val.(type) {
+	case nil:
+		return null
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case json.RawMessage:
+		return string(v)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	}
+	return fmt.Sprint(val)
+}
+
+// importRecords is POST /$table/_import, the body is CSV with a header or NDJSON.
+// The format is taken from ?format= or Content-Type. Records are checked and created
+// the same way as by PUT /$table, all of them in one transaction, the first error rolls back everything.
+// Unlike PUT, values of auto increment columns are kept, so references to imported records stay valid.
+func (exp *dBExplorer) importRecords(w http.ResponseWriter, r *http.Request) {
+	table, ok := exp.parseTableURL(w, r)
+	if !ok {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatByContentType(r.Header.Get("Content-Type"))
+	}
+
+	var next func() (map[string]interface{}, int, error)
+	switch format {
+	case formatCSV:
+		var err error
+		next, err = csvRecords(r.Body, table, r.URL.Query().Get("null"))
+		if err != nil {
+			writeResponseJSON(w, http.StatusBadRequest, "", nil, err.Error())
+			return
+		}
+	case formatNDJSON:
+		next = ndjsonRecords(r.Body)
+	default:
+		writeResponseJSON(w, http.StatusBadRequest, "", nil, "unknown format, use ?format=csv or ?format=ndjson")
+		return
+	}
+
+	tx, err := exp.db.Begin()
+	if err != nil {
+		writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	var imported int64
+	for {
+		record, line, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeResponseJSON(w, http.StatusBadRequest, "", nil, fmt.Sprintf("line %d: %s", line, err.Error()))
+			return
+		}
+
+		res, err := exp.bulkOp(tx, table, bulkOp{Op: "create", Record: record, keepKeys: true}, false)
+		if err != nil {
+			writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
+			return
+		}
+		if res.Error != "" {
+			writeResponseJSON(w, res.Status, "", nil, fmt.Sprintf("line %d: %s", line, res.Error))
+			return
+		}
+		imported++
+	}
+
+	for _, col := range table.primaryKey {
+		if col.isAutoIncrement() {
+			if err = exp.dialect.syncCounter(tx, table.name, col.field); err != nil {
+				writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
+				return
+			}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
+		return
+	}
+
+	writeResponseJSON(w, http.StatusOK, "imported", imported, "")
+}
+
+func formatByContentType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return formatCSV
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return formatNDJSON
+	}
+	return ""
+}
+
+// csvRecords reads the header and maps it to the columns, then returns records one by one
+// with their line numbers, io.EOF is the end.
+// A value equal to null is missing: it's filled by the database for auto increment columns, NULL for nullable columns,
+// the default for columns with it, an empty string for the rest. An empty value is missing as well unless the column is text,
+// so with null other than "" empty strings and NULLs of text columns are told apart.
+func csvRecords(body io.Reader, table *tableInfo, null string) (func() (map[string]interface{}, int, error), error) {
+	cr := csv.NewReader(body)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("header is missing")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]*columnInfo, 0, len(header))
+	for _, name := range header {
+		col := table.column(strings.TrimSpace(name))
+		if col == nil {
+			return nil, fmt.Errorf("unknown field %s", name)
+		}
+		columns = append(columns, col)
+	}
+
+	return func() (map[string]interface{}, int, error) {
+		row, err := cr.Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return nil, parseErr.StartLine, parseErr.Err
+			}
+			return nil, 0, err
+		}
+		line, _ := cr.FieldPos(0)
+
+		record := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			kind := columnKind(col.typeName)
+			if row[i] == null || row[i] == "" && kind != kindString && kind != kindBlob {
+				// the database fills the key, as if the column was missing
+				if col.isAutoIncrement() {
+					continue
+				}
+				if col.isNull {
+					record[col.field] = nil
+					continue
+				}
+				// the column gets its default, as if the field was missing in JSON
+				if col.defaultVal != nil {
+					continue
+				}
+			}
+
+			record[col.field], err = csvField(col, row[i])
+			if err != nil {
+				return nil, line, err
+			}
+		}
+		return record, line, nil
+	}, nil
+}
+
+// csvField turns the text into the value JSON would have, so it's checked by validateFields as usual.
+// Numbers stay json.Number, big integers don't fit float64.
+func csvField(col *columnInfo, raw string) (interface{}, error) {
+	var val interface{}
+	var err error
+	switch columnKind(col.typeName) {
+	case kindInt:
+		val = json.Number(raw)
+		_, err = strconv.ParseInt(raw, 10, 64)
+	case kindUint:
+		val = json.Number(raw)
+		_, err = strconv.ParseUint(raw, 10, 64)
+	case kindFloat:
+		val = json.Number(raw)
+		_, err = strconv.ParseFloat(raw, 64)
+	case kindBool:
+		val, err = strconv.ParseBool(raw)
+	case kindJSON:
+		err = decodeJSON(strings.NewReader(raw), &val)
+	default:
+		val = raw
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("field %s have invalid type", col.field)
+	}
+	return val, nil
+}
+
+// ndjsonRecords returns objects one by one with their line numbers, empty lines are skipped, io.EOF is the end
+func ndjsonRecords(body io.Reader) func() (map[string]interface{}, int, error) {
+	br := bufio.NewReader(body)
+	line := 0
+
+	return func() (map[string]interface{}, int, error) {
+		for {
+			data, err := br.ReadBytes('\n')
+			if len(data) == 0 && err != nil {
+				return nil, line, err
+			}
+			line++
+
+			data = bytes.TrimSpace(data)
+			if len(data) == 0 {
+				continue
+			}
+
+			var record map[string]interface{}
+			if err = decodeJSON(bytes.NewReader(data), &record); err != nil {
+				return nil, line, err
+			}
+			return record, line, nil
+		}
+	}
+}
@@ -104,7 +104,12 @@ func TestApis(t *testing.T) {
 
 	ts := httptest.NewServer(handler)
 
-	cases := []Case{
+	runCases(t, ts, db, apiCases())
+}
+
+// apiCases are the same for every database
+func apiCases() []Case {
+	return []Case{
 		Case{
 			Path: "/", // список таблиц
 			Result: CR{
@@ -496,8 +501,6 @@ func TestApis(t *testing.T) {
 			},
 		},
 	}
-
-	runCases(t, ts, db, cases)
 }
 
 func runCases(t *testing.T, ts *httptest.Server, db *sql.DB, cases []Case) {
@@ -547,6 +550,10 @@ func runCases(t *testing.T, ts *httptest.Server, db *sql.DB, cases []Case) {
 			continue
 		}
 
+		if contentType := resp.Header.Get("Content-Type"); contentType != "application/json" {
+			t.Fatalf("[%s] expected Content-Type application/json, got %q", caseName, contentType)
+		}
+
 		err = json.Unmarshal(body, &result)
 		if err != nil {
 			t.Fatalf("[%s] cant unpack json: %v", caseName, err)
@@ -1,8 +1,13 @@
 package main
 
+import "strings"
+
 type tableInfo struct {
-	name    string
-	columns []*columnInfo
+	name        string
+	columns     []*columnInfo
+	primaryKey  []*columnInfo // in the order of columns, composite keys have several
+	foreignKeys []*foreignKeyInfo
+	indexes     []*indexInfo
 }
 
 type columnInfo struct {
@@ -13,3 +18,43 @@ type columnInfo struct {
 	defaultVal *string
 	extra      string
 }
+
+type foreignKeyInfo struct {
+	name       string
+	columns    []string
+	refTable   string
+	refColumns []string
+}
+
+type indexInfo struct {
+	name    string
+	columns []string
+	unique  bool
+}
+
+func newTableInfo(name string, columns []*columnInfo) *tableInfo {
+	t := &tableInfo{name: name, columns: columns}
+	for _, col := range columns {
+		if col.isPrimary() {
+			t.primaryKey = append(t.primaryKey, col)
+		}
+	}
+	return t
+}
+
+func (col *columnInfo) isPrimary() bool {
+	return col.key == "PRI"
+}
+
+func (col *columnInfo) isAutoIncrement() bool {
+	return strings.Contains(col.extra, "auto_increment")
+}
+
+func (t *tableInfo) column(name string) *columnInfo {
+	for _, col := range t.columns {
+		if col.field == name {
+			return col
+		}
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// listQuery holds parameters of GET /$table checked against the columns of the table:
+//
+//	?where=status:eq:active&where=age:gte:18 - conditions joined by AND
+//	?sort=-created_at,id - order, minus means descending
+//	?fields=id,title - selected columns
+//	?cursor= - keyset pagination, the first page has an empty cursor, the next ones take next_cursor
+//	?count=true - total amount of records matching the conditions
+//	?format=csv or ?format=ndjson - all records are streamed in the format, unless limit is given
+//	?null=\N - how NULL is written in CSV, an empty value by default
+type listQuery struct {
+	fields []*columnInfo
+	where  []condition
+	sort   []sortColumn
+	limit  int64
+	offset int64
+
+	// order is sort with primary key columns added, so every record has its own place
+	order  []sortColumn
+	cursor bool
+	after  []interface{} // values of order columns of the last record of the previous page
+	count  bool
+	format string
+	null   string
+}
+
+type condition struct {
+	column *columnInfo
+	op     string
+	values []interface{}
+}
+
+type sortColumn struct {
+	column *columnInfo
+	desc   bool
+}
+
+// operators maps where operators to SQL, in takes values separated by |, null and notnull take none
+var operators = map[string]string{
+	"eq":      "=",
+	"ne":      "<>",
+	"lt":      "<",
+	"lte":     "<=",
+	"gt":      ">",
+	"gte":     ">=",
+	"like":    "LIKE",
+	"in":      "IN",
+	"null":    "IS NULL",
+	"notnull": "IS NOT NULL",
+}
+
+func parseListQuery(query url.Values, table *tableInfo, d dialect) (*listQuery, error) {
+	q := &listQuery{limit: 5}
+
+	switch format := query.Get("format"); format {
+	case "", "json":
+	case formatCSV, formatNDJSON:
+		// exports have no limit by default, offset works only with limit then
+		q.format = format
+		q.limit = -1
+		q.null = query.Get("null")
+	default:
+		return nil, fmt.Errorf("unknown format %s", format)
+	}
+
+	// if limit or offset is not a number - take the default one
+	limit, err := strconv.ParseInt(query.Get("limit"), 0, 32)
+	if err == nil {
+		q.limit = limit
+	}
+	offset, err := strconv.ParseInt(query.Get("offset"), 0, 32)
+	if err == nil {
+		q.offset = offset
+	}
+
+	if query.Get("fields") == "" {
+		q.fields = table.columns
+	} else {
+		for _, name := range strings.Split(query.Get("fields"), ",") {
+			col := table.column(name)
+			if col == nil {
+				return nil, fmt.Errorf("unknown field %s", name)
+			}
+			q.fields = append(q.fields, col)
+		}
+	}
+
+	for _, raw := range query["where"] {
+		cond, err := parseCondition(raw, table, d)
+		if err != nil {
+			return nil, err
+		}
+		q.where = append(q.where, cond)
+	}
+
+	if query.Get("sort") != "" {
+		for _, name := range strings.Split(query.Get("sort"), ",") {
+			s := sortColumn{desc: strings.HasPrefix(name, "-")}
+			s.column = table.column(strings.TrimPrefix(name, "-"))
+			if s.column == nil {
+				return nil, fmt.Errorf("unknown field %s", strings.TrimPrefix(name, "-"))
+			}
+			q.sort = append(q.sort, s)
+		}
+	}
+
+	q.order = append(q.order, q.sort...)
+	for _, col := range table.primaryKey {
+		if !q.sorted(col) {
+			q.order = append(q.order, sortColumn{column: col})
+		}
+	}
+
+	if q.count, err = strconv.ParseBool(query.Get("count")); err != nil {
+		q.count = false
+	}
+
+	if q.format != "" && (q.count || query["cursor"] != nil) {
+		return nil, fmt.Errorf("format %s can't be used with cursor or count", q.format)
+	}
+
+	if _, ok := query["cursor"]; ok {
+		if err = q.parseCursor(query.Get("cursor"), table, d); err != nil {
+			return nil, err
+		}
+	}
+
+	return q, nil
+}
+
+func (q *listQuery) sorted(col *columnInfo) bool {
+	for _, s := range q.order {
+		if s.column == col {
+			return true
+		}
+	}
+	return false
+}
+
+// columns are selected columns, the requested ones and the ones needed for the cursor
+func (q *listQuery) columns() []*columnInfo {
+	columns := append([]*columnInfo{}, q.fields...)
+	if !q.cursor {
+		return columns
+	}
+
+	for _, s := range q.order {
+		selected := false
+		for _, col := range columns {
+			selected = selected || col == s.column
+		}
+		if !selected {
+			columns = append(columns, s.column)
+		}
+	}
+	return columns
+}
+
+// parseCondition parses column:operator:value, the value may contain colons
+func parseCondition(raw string, table *tableInfo, d dialect) (condition, error) {
+	parts := strings.SplitN(raw, ":", 3)
+	if len(parts) < 2 {
+		return condition{}, fmt.Errorf("invalid where %s, must be field:operator:value", raw)
+	}
+
+	cond := condition{column: table.column(parts[0]), op: parts[1]}
+	if cond.column == nil {
+		return cond, fmt.Errorf("unknown field %s", parts[0])
+	}
+	if _, ok := operators[cond.op]; !ok {
+		return cond, fmt.Errorf("unknown operator %s", cond.op)
+	}
+
+	switch {
+	case cond.op == "null" || cond.op == "notnull":
+		if len(parts) == 3 {
+			return cond, fmt.Errorf("operator %s takes no value", cond.op)
+		}
+		return cond, nil
+	case len(parts) < 3:
+		return cond, fmt.Errorf("operator %s needs a value", cond.op)
+	}
+
+	rawValues := []string{parts[2]}
+	if cond.op == "in" {
+		rawValues = strings.Split(parts[2], "|")
+	}
+	for _, rawValue := range rawValues {
+		val, err := parseValue(cond.column, rawValue, d)
+		if err != nil {
+			return cond, err
+		}
+		cond.values = append(cond.values, val)
+	}
+
+	return cond, nil
+}
+
+// whereClause compiles conditions, placeholders are numbered after args, which get the values
+func (exp *dBExplorer) whereClause(q *listQuery, args *[]interface{}) string {
+	conds := make([]string, 0, len(q.where)+1)
+	for _, cond := range q.where {
+		column := exp.dialect.quote(cond.column.field)
+		switch cond.op {
+		case "null", "notnull":
+			conds = append(conds, fmt.Sprintf("%s %s", column, operators[cond.op]))
+		case "in":
+			placeholders := make([]string, 0, len(cond.values))
+			for _, val := range cond.values {
+				*args = append(*args, val)
+				placeholders = append(placeholders, exp.dialect.placeholder(len(*args)))
+			}
+			conds = append(conds, fmt.Sprintf("%s IN (%s)", column, strings.Join(placeholders, ", ")))
+		default:
+			*args = append(*args, cond.values[0])
+			conds = append(conds, fmt.Sprintf("%s %s %s", column, operators[cond.op], exp.dialect.placeholder(len(*args))))
+		}
+	}
+
+	if q.after != nil {
+		conds = append(conds, exp.afterCondition(q, args))
+	}
+
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// selectQuery compiles the list query into SQL with parameters.
+// With the cursor one more record is selected to know if there is the next page.
+func (exp *dBExplorer) selectQuery(table *tableInfo, q *listQuery) (string, []interface{}) {
+	colNames := make([]string, 0)
+	for _, col := range q.columns() {
+		colNames = append(colNames, col.field)
+	}
+
+	args := make([]interface{}, 0)
+	query := fmt.Sprintf("SELECT %s FROM %s", exp.quoteNames(colNames), exp.dialect.quote(table.name))
+	query += exp.whereClause(q, &args)
+
+	order := make([]string, 0, len(q.order))
+	for _, s := range q.order {
+		if s.desc {
+			order = append(order, exp.dialect.quote(s.column.field)+" DESC")
+		} else {
+			order = append(order, exp.dialect.quote(s.column.field)+" ASC")
+		}
+	}
+	if len(order) > 0 {
+		query += " ORDER BY " + strings.Join(order, ", ")
+	}
+
+	switch {
+	case q.cursor:
+		query += fmt.Sprintf(" LIMIT %d", q.limit+1)
+	case q.limit < 0:
+		// every record is exported
+	default:
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", q.limit, q.offset)
+	}
+	return query, args
+}
+
+// countQuery counts records matching the conditions, the cursor and the limit don't matter
+func (exp *dBExplorer) countQuery(table *tableInfo, q *listQuery) (string, []interface{}) {
+	args := make([]interface{}, 0)
+	where := exp.whereClause(&listQuery{where: q.where}, &args)
+	return fmt.Sprintf("SELECT COUNT(*) FROM %s%s", exp.dialect.quote(table.name), where), args
+}
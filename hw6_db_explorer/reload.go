@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// option configures the explorer in newDbExplorer
+type option func(exp *dBExplorer)
+
+// withSchemaRefresh reloads the schema every interval until ctx is done,
+// so tables and columns added by migrations show up without a restart
+func withSchemaRefresh(ctx context.Context, interval time.Duration) option {
+	return func(exp *dBExplorer) {
+		exp.refreshCtx = ctx
+		exp.refreshInterval = interval
+	}
+}
+
+// withSchemaTimeout limits every loading of the schema, 0 means no limit
+func withSchemaTimeout(timeout time.Duration) option {
+	return func(exp *dBExplorer) {
+		exp.schemaTimeout = timeout
+	}
+}
+
+// withSkipUnreadableTables leaves out tables which can't be read instead of failing,
+// they are logged and listed in the response of POST /_reload
+func withSkipUnreadableTables() option {
+	return func(exp *dBExplorer) {
+		exp.skipUnreadable = true
+	}
+}
+
+func (exp *dBExplorer) refreshSchema(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, _, err := exp.reloadSchema()
+			if err != nil {
+				log.Printf("schema refresh failed: %v", err)
+			} else if changed {
+				log.Printf("schema changed, %d tables loaded", len(exp.tables()))
+			}
+		}
+	}
+}
+
+// reloadSchema reads the schema again and swaps it if it has changed.
+// If reading fails the old schema is kept.
+func (exp *dBExplorer) reloadSchema() (bool, map[string]error, error) {
+	exp.reloadMu.Lock()
+	defer exp.reloadMu.Unlock()
+
+	tables, skipped, err := exp.loadDBInfo()
+	if err != nil {
+		return false, nil, err
+	}
+	logSkipped(skipped)
+
+	if reflect.DeepEqual(tables, exp.tables()) {
+		return false, skipped, nil
+	}
+	exp.schema.Store(tables)
+	return true, skipped, nil
+}
+
+// reloadTables is the admin endpoint POST /_reload, it's for running right after a migration
+func (exp *dBExplorer) reloadTables(w http.ResponseWriter, r *http.Request) {
+	changed, skipped, err := exp.reloadSchema()
+	if err != nil {
+		writeResponseJSON(w, http.StatusInternalServerError, "", nil, err.Error())
+		return
+	}
+
+	skippedErrors := make(map[string]string, len(skipped))
+	for name, err := range skipped {
+		skippedErrors[name] = err.Error()
+	}
+
+	writeResponseFieldsJSON(w, http.StatusOK, map[string]interface{}{"changed": changed, "tables": exp.tableNames(), "skipped": skippedErrors})
+}
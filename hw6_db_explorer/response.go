@@ -26,6 +26,22 @@ func writeResponseJSON(w http.ResponseWriter, status int, responseName string, d
 		}
 	}
 
+	writeJSON(w, status, resp)
+}
+
+// writeResponseFieldsJSON writes every field as a separate key of the response, e.g. all columns of a composite key
+func writeResponseFieldsJSON(w http.ResponseWriter, status int, fields map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, status, response{Response: fields})
+}
+
+// writeErrorFieldsJSON writes the error together with the response, e.g. results of ops before the failed one
+func writeErrorFieldsJSON(w http.ResponseWriter, status int, errorText string, fields map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, status, response{Error: errorText, Response: fields})
+}
+
+func writeJSON(w http.ResponseWriter, status int, resp response) {
 	jsonResp, err := json.Marshal(resp)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
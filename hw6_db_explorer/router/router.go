@@ -14,6 +14,15 @@ type Router struct {
 	postRoutes   map[int]http.HandlerFunc
 	putRoutes    map[int]http.HandlerFunc
 	deleteRoutes map[int]http.HandlerFunc
+
+	// named routes are found by HTTP method, amount of params and the last part of the path
+	namedRoutes map[namedRoute]http.HandlerFunc
+}
+
+type namedRoute struct {
+	httpMethod   string
+	paramsAmount int
+	name         string
 }
 
 func New() *Router {
@@ -22,6 +31,7 @@ func New() *Router {
 		postRoutes:   make(map[int]http.HandlerFunc),
 		putRoutes:    make(map[int]http.HandlerFunc),
 		deleteRoutes: make(map[int]http.HandlerFunc),
+		namedRoutes:  make(map[namedRoute]http.HandlerFunc),
 	}
 }
 
@@ -48,10 +58,31 @@ func (rt *Router) RegisterRoute(httpMethod string, paramsAmount int, hf http.Han
 	return nil
 }
 
+// RegisterNamedRoute registers a route by amount of params and the last part of the path,
+// it takes precedence over the route with the same amount of params.
+// Example: 2 params and name _schema match /$table/_schema, but not /_schema or /$table/$id.
+// The name is compared with the escaped path, so an id equal to the name can still be reached as %5Fschema
+func (rt *Router) RegisterNamedRoute(httpMethod string, paramsAmount int, name string, hf http.HandlerFunc) error {
+	switch httpMethod {
+	case "GET", "POST", "PUT", "DELETE":
+	default:
+		return fmt.Errorf("unsupported http method: %s", httpMethod)
+	}
+
+	rt.namedRoutes[namedRoute{httpMethod, paramsAmount, name}] = hf
+
+	return nil
+}
+
 func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var handler http.HandlerFunc
 	paramsAmount := resolveParamsAmount(r.URL.Path)
 
+	if h, ok := rt.namedRoutes[namedRoute{r.Method, paramsAmount, lastParam(r.URL.EscapedPath())}]; ok {
+		h(w, r)
+		return
+	}
+
 	switch r.Method {
 	case "GET":
 		h, ok := rt.getRoutes[paramsAmount]
@@ -86,6 +117,7 @@ func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		handler = h
 	default:
 		w.WriteHeader(http.StatusNotImplemented)
+		return
 	}
 
 	handler(w, r)
@@ -107,3 +139,8 @@ func resolveParamsAmount(urlPath string) int {
 
 	return count
 }
+
+func lastParam(urlPath string) string {
+	path := strings.TrimRight(urlPath, "/")
+	return path[strings.LastIndex(path, "/")+1:]
+}
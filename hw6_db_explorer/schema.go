@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+)
+
+// formats tell clients how values of the column look in JSON
+var kindFormats = map[typeKind]string{
+	kindString:   "string",
+	kindInt:      "integer",
+	kindUint:     "integer",
+	kindFloat:    "number",
+	kindDecimal:  "decimal",
+	kindBool:     "boolean",
+	kindDateTime: "datetime",
+	kindDate:     "date",
+	kindJSON:     "json",
+	kindBlob:     "base64",
+}
+
+type columnSchema struct {
+	Field         string   `json:"field"`
+	Type          string   `json:"type"`
+	Format        string   `json:"format"`
+	Null          bool     `json:"null"`
+	Key           string   `json:"key"`
+	Default       *string  `json:"default"`
+	AutoIncrement bool     `json:"auto_increment"`
+	Enum          []string `json:"enum,omitempty"`
+}
+
+type foreignKeySchema struct {
+	Name       string   `json:"name"`
+	Columns    []string `json:"columns"`
+	RefTable   string   `json:"ref_table"`
+	RefColumns []string `json:"ref_columns"`
+}
+
+type indexSchema struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+}
+
+// schemaFields describes the table for the /$table/_schema response
+func schemaFields(table *tableInfo) map[string]interface{} {
+	columns := make([]columnSchema, 0, len(table.columns))
+	for _, col := range table.columns {
+		columns = append(columns, columnSchema{
+			Field:         col.field,
+			Type:          col.typeName,
+			Format:        kindFormats[columnKind(col.typeName)],
+			Null:          col.isNull,
+			Key:           col.key,
+			Default:       col.defaultVal,
+			AutoIncrement: col.isAutoIncrement(),
+			Enum:          enumValues(col.typeName),
+		})
+	}
+
+	primaryKey := make([]string, 0, len(table.primaryKey))
+	for _, col := range table.primaryKey {
+		primaryKey = append(primaryKey, col.field)
+	}
+
+	foreignKeys := make([]foreignKeySchema, 0, len(table.foreignKeys))
+	for _, fk := range table.foreignKeys {
+		foreignKeys = append(foreignKeys, foreignKeySchema{
+			Name:       fk.name,
+			Columns:    fk.columns,
+			RefTable:   fk.refTable,
+			RefColumns: fk.refColumns,
+		})
+	}
+
+	indexes := make([]indexSchema, 0, len(table.indexes))
+	for _, index := range table.indexes {
+		indexes = append(indexes, indexSchema{
+			Name:    index.name,
+			Columns: index.columns,
+			Unique:  index.unique,
+		})
+	}
+
+	return map[string]interface{}{
+		"table":        table.name,
+		"columns":      columns,
+		"primary_key":  primaryKey,
+		"foreign_keys": foreignKeys,
+		"indexes":      indexes,
+	}
+}
+
+func (exp *dBExplorer) getTableSchema(w http.ResponseWriter, r *http.Request) {
+	table, ok := exp.parseTableURL(w, r)
+	if !ok {
+		return
+	}
+
+	writeResponseFieldsJSON(w, http.StatusOK, schemaFields(table))
+}
@@ -0,0 +1,1282 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// тот же набор запросов, что и в TestApis, но на SQLite - ему не нужен запущенный сервер базы
+
+func PrepareTestApisSQLite(db *sql.DB) {
+	qs := []string{
+		`CREATE TABLE items (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  title varchar(255) NOT NULL,
+  description text NOT NULL,
+  updated varchar(255) DEFAULT NULL
+);`,
+
+		`INSERT INTO items (id, title, description, updated) VALUES
+(1,	'database/sql',	'Рассказать про базы данных',	'rvasily'),
+(2,	'memcache',	'Рассказать про мемкеш с примером использования',	NULL);`,
+
+		`CREATE TABLE users (
+  user_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  login varchar(255) NOT NULL,
+  password varchar(255) NOT NULL,
+  email varchar(255) NOT NULL,
+  info text NOT NULL,
+  updated varchar(255) DEFAULT NULL
+);`,
+
+		`INSERT INTO users (user_id, login, password, email, info, updated) VALUES
+(1,	'rvasily',	'love',	'rvasily@example.com',	'none',	NULL);`,
+	}
+
+	for _, q := range qs {
+		_, err := db.Exec(q)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// openSQLite creates an empty database, it's removed after the test
+func openSQLite(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "explorer.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestApisSQLite(t *testing.T) {
+	db := openSQLite(t)
+
+	PrepareTestApisSQLite(db)
+
+	handler, err := newDbExplorer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	runCases(t, ts, db, apiCases())
+}
+
+func TestPrimaryKeysSQLite(t *testing.T) {
+	db := openSQLite(t)
+
+	qs := []string{
+		// строковый ключ, и он не первая колонка
+		`CREATE TABLE tags (
+  title varchar(255) NOT NULL,
+  slug varchar(64) NOT NULL PRIMARY KEY
+);`,
+		`INSERT INTO tags (title, slug) VALUES ('Go', 'go'), ('A, B', 'a,b');`,
+		// составной ключ
+		`CREATE TABLE members (
+  group_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  role varchar(32) NOT NULL,
+  PRIMARY KEY (group_id, user_id)
+);`,
+		`INSERT INTO members (group_id, user_id, role) VALUES (1, 1, 'owner');`,
+	}
+	for _, q := range qs {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler, err := newDbExplorer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path: "/tags/go",
+			Result: CR{
+				"response": CR{
+					"record": CR{"title": "Go", "slug": "go"},
+				},
+			},
+		},
+		Case{
+			Path: "/tags/a%2Cb",
+			Result: CR{
+				"response": CR{
+					"record": CR{"title": "A, B", "slug": "a,b"},
+				},
+			},
+		},
+		Case{
+			Path:   "/tags/",
+			Method: http.MethodPut,
+			Body:   CR{"title": "SQL", "slug": "sql"},
+			Result: CR{
+				"response": CR{"slug": "sql"},
+			},
+		},
+		Case{
+			Path:   "/tags/sql",
+			Method: http.MethodPost,
+			Status: http.StatusBadRequest,
+			Body:   CR{"slug": "mysql"},
+			Result: CR{
+				"error": "field slug have invalid type",
+			},
+		},
+		Case{
+			Path:   "/tags/sql",
+			Method: http.MethodDelete,
+			Result: CR{
+				"response": CR{"deleted": 1},
+			},
+		},
+
+		Case{
+			Path: "/members/1,1",
+			Result: CR{
+				"response": CR{
+					"record": CR{"group_id": 1, "user_id": 1, "role": "owner"},
+				},
+			},
+		},
+		Case{
+			Path:   "/members/1",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "primary key of table members has 2 columns, got 1 values",
+			},
+		},
+		Case{
+			Path:   "/members/1,x",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "field user_id have invalid type",
+			},
+		},
+		Case{
+			Path:   "/members/",
+			Method: http.MethodPut,
+			Body:   CR{"group_id": 1, "user_id": 2, "role": "guest"},
+			Result: CR{
+				"response": CR{"group_id": 1, "user_id": 2},
+			},
+		},
+		Case{
+			Path:   "/members/1,2",
+			Method: http.MethodPost,
+			Body:   CR{"role": "admin"},
+			Result: CR{
+				"response": CR{"updated": 1},
+			},
+		},
+		Case{
+			Path: "/members/1,2",
+			Result: CR{
+				"response": CR{
+					"record": CR{"group_id": 1, "user_id": 2, "role": "admin"},
+				},
+			},
+		},
+		Case{
+			Path:   "/members/1,2",
+			Method: http.MethodDelete,
+			Result: CR{
+				"response": CR{"deleted": 1},
+			},
+		},
+	})
+}
+
+func TestListQuerySQLite(t *testing.T) {
+	db := openSQLite(t)
+	PrepareTestApisSQLite(db)
+
+	handler, err := newDbExplorer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:  "/items",
+			Query: "where=updated:null&fields=id,title",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"id": 2, "title": "memcache"},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "where=id:gte:1&where=title:like:%25sql&fields=id",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"id": 1},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "sort=-id&fields=title,id",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"id": 2, "title": "memcache"},
+						CR{"id": 1, "title": "database/sql"},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "where=id:in:1|2&where=updated:notnull&sort=-id&fields=id",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"id": 1},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "fields=id,password",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "unknown field password",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "where=id:gt:x",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "field id have invalid type",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "where=id:between:1",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "unknown operator between",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "sort=-created",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "unknown field created",
+			},
+		},
+	})
+}
+
+func TestCursorSQLite(t *testing.T) {
+	db := openSQLite(t)
+	_, err := db.Exec(`CREATE TABLE events (
+  id INTEGER PRIMARY KEY,
+  kind varchar(16) NOT NULL,
+  note text
+);
+CREATE TABLE logins (
+  id INTEGER PRIMARY KEY,
+  at DATETIME NOT NULL
+);
+INSERT INTO logins (id, at) VALUES
+(1, '2024-01-01 10:00:00'),
+(2, '2024-01-01 10:00:00'),
+(3, '2024-01-01 10:00:00'),
+(4, '2024-01-02 10:00:00');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// kinds repeat, so the order inside a kind depends on id
+	type event struct {
+		id   int
+		kind string
+	}
+	events := make([]event, 0)
+	for id := 1; id <= 23; id++ {
+		e := event{id: id, kind: string(rune('a' + id%3))}
+		if _, err = db.Exec(`INSERT INTO events (id, kind) VALUES (?, ?)`, e.id, e.kind); err != nil {
+			t.Fatal(err)
+		}
+		if id > 2 {
+			events = append(events, e)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].kind != events[j].kind {
+			return events[i].kind > events[j].kind
+		}
+		return events[i].id < events[j].id
+	})
+	want := make([]int, 0)
+	for _, e := range events {
+		want = append(want, e.id)
+	}
+
+	handler, err := newDbExplorer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	get := func(table string, query url.Values) (int, map[string]interface{}) {
+		resp, err := client.Get(ts.URL + "/" + table + "?" + query.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		result := make(map[string]interface{})
+		if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, result
+	}
+
+	got := make([]int, 0)
+	cursor := ""
+	for page := 0; ; page++ {
+		if page > len(want) {
+			t.Fatalf("pagination doesn't end")
+		}
+
+		query := url.Values{"where": {"id:gt:2"}, "sort": {"-kind"}, "fields": {"id"}, "limit": {"4"}, "cursor": {cursor}, "count": {"true"}}
+		status, result := get("events", query)
+		if status != http.StatusOK {
+			t.Fatalf("page %d: status %d, %v", page, status, result)
+		}
+
+		resp := result["response"].(map[string]interface{})
+		if resp["total"] != float64(len(want)) {
+			t.Fatalf("page %d: total %v, want %d", page, resp["total"], len(want))
+		}
+		for _, record := range resp["records"].([]interface{}) {
+			fields := record.(map[string]interface{})
+			if len(fields) != 1 {
+				t.Fatalf("page %d: fields %v, want only id", page, fields)
+			}
+			got = append(got, int(fields["id"].(float64)))
+		}
+
+		if resp["next_cursor"] == nil {
+			break
+		}
+		cursor = resp["next_cursor"].(string)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("pages give %v, want %v", got, want)
+	}
+
+	errorCases := []struct {
+		query url.Values
+		error string
+	}{
+		{url.Values{"cursor": {"bm9wZQ"}}, "invalid cursor"},
+		{url.Values{"cursor": {cursor}}, "invalid cursor"}, // it was made for another order
+		{url.Values{"cursor": {""}, "sort": {"note"}}, "field note can be null, it can't be sorted with cursor"},
+		{url.Values{"cursor": {""}, "limit": {"0"}}, "limit must be positive with cursor"},
+	}
+	for _, c := range errorCases {
+		status, result := get("events", c.query)
+		if status != http.StatusBadRequest || result["error"] != c.error {
+			t.Fatalf("%s: status %d, %v, want error %q", c.query.Encode(), status, result, c.error)
+		}
+	}
+
+	// without a cursor the response stays the same, count only adds total
+	status, result := get("events", url.Values{"where": {"kind:eq:a"}, "fields": {"id"}, "limit": {"1"}, "offset": {"1"}, "count": {"true"}})
+	wantResult := map[string]interface{}{
+		"response": map[string]interface{}{
+			"records": []interface{}{map[string]interface{}{"id": float64(6)}},
+			"total":   float64(7),
+		},
+	}
+	if status != http.StatusOK || !reflect.DeepEqual(result, wantResult) {
+		t.Fatalf("status %d, %v, want %v", status, result, wantResult)
+	}
+
+	// logins 1-3 have the same time, a page ending in the middle of them must not lose the rest
+	got = make([]int, 0)
+	cursor = ""
+	for page := 0; ; page++ {
+		if page > 4 {
+			t.Fatalf("pagination doesn't end")
+		}
+
+		status, result := get("logins", url.Values{"sort": {"at"}, "fields": {"id"}, "limit": {"2"}, "cursor": {cursor}})
+		if status != http.StatusOK {
+			t.Fatalf("page %d: status %d, %v", page, status, result)
+		}
+
+		resp := result["response"].(map[string]interface{})
+		for _, record := range resp["records"].([]interface{}) {
+			got = append(got, int(record.(map[string]interface{})["id"].(float64)))
+		}
+
+		if resp["next_cursor"] == nil {
+			break
+		}
+		cursor = resp["next_cursor"].(string)
+	}
+	if want = []int{1, 2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pages by time give %v, want %v", got, want)
+	}
+}
+
+func TestColumnTypesSQLite(t *testing.T) {
+	db := openSQLite(t)
+	_, err := db.Exec(`CREATE TABLE things (
+  id INTEGER PRIMARY KEY,
+  big BIGINT,
+  price DECIMAL(10,2),
+  ratio FLOAT,
+  created DATETIME,
+  day DATE,
+  active BOOLEAN,
+  flag TINYINT(1),
+  meta JSON,
+  data BLOB,
+  amount INT
+);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := newDbExplorer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	thing := CR{
+		"id":      1,
+		"big":     9007199254740991,
+		"price":   "12.5",
+		"ratio":   0.25,
+		"created": "2024-03-01T10:20:30Z",
+		"day":     "2024-03-01",
+		"active":  true,
+		"flag":    true,
+		"meta":    CR{"tags": []string{"a", "b"}},
+		"data":    "aGVsbG8=", // hello
+		"amount":  nil,
+	}
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:   "/things/",
+			Method: http.MethodPut,
+			Body: CR{
+				"big":     9007199254740991,
+				"price":   "12.50",
+				"ratio":   0.25,
+				"created": "2024-03-01T10:20:30Z",
+				"day":     "2024-03-01",
+				"active":  true,
+				"flag":    1,
+				"meta":    CR{"tags": []string{"a", "b"}},
+				"data":    "aGVsbG8=",
+				"amount":  nil,
+			},
+			Result: CR{
+				"response": CR{"id": 1},
+			},
+		},
+		Case{
+			Path: "/things/1",
+			Result: CR{
+				"response": CR{"record": thing},
+			},
+		},
+		Case{
+			Path:  "/things",
+			Query: "where=created:gte:2024-03-01&where=active:eq:true&where=data:eq:aGVsbG8%3D",
+			Result: CR{
+				"response": CR{"records": []CR{thing}},
+			},
+		},
+		Case{
+			Path:   "/things/1",
+			Method: http.MethodPost,
+			Body:   CR{"amount": 7, "price": 3, "meta": "text", "active": false},
+			Result: CR{
+				"response": CR{"updated": 1},
+			},
+		},
+		Case{
+			Path:  "/things",
+			Query: "fields=amount,price,meta,active",
+			Result: CR{
+				"response": CR{"records": []CR{
+					CR{"amount": 7, "price": "3", "meta": "text", "active": false},
+				}},
+			},
+		},
+
+		// ошибки
+		Case{
+			Path:   "/things/1",
+			Method: http.MethodPost,
+			Status: http.StatusBadRequest,
+			Body:   CR{"amount": 1.5},
+			Result: CR{"error": "field amount have invalid type"},
+		},
+		Case{
+			Path:   "/things/1",
+			Method: http.MethodPost,
+			Status: http.StatusBadRequest,
+			Body:   CR{"created": "yesterday"},
+			Result: CR{"error": "field created have invalid type"},
+		},
+		Case{
+			Path:   "/things/1",
+			Method: http.MethodPost,
+			Status: http.StatusBadRequest,
+			Body:   CR{"active": "yes"},
+			Result: CR{"error": "field active have invalid type"},
+		},
+		Case{
+			Path:   "/things/1",
+			Method: http.MethodPost,
+			Status: http.StatusBadRequest,
+			Body:   CR{"price": "cheap"},
+			Result: CR{"error": "field price have invalid type"},
+		},
+		Case{
+			Path:   "/things/",
+			Method: http.MethodPut,
+			Status: http.StatusBadRequest,
+			Body:   CR{"data": "not base64!"},
+			Result: CR{"error": "field data have invalid type"},
+		},
+	})
+}
+
+// times of SQLite are text, the ones from the URL and bodies must be written the same way as by SQL
+func TestTimesSQLite(t *testing.T) {
+	db := openSQLite(t)
+	_, err := db.Exec(`CREATE TABLE visits (
+  id INTEGER PRIMARY KEY,
+  at DATETIME NOT NULL,
+  day DATE
+);
+INSERT INTO visits (id, at, day) VALUES
+(1, '2024-01-01 10:00:00', '2024-01-01'),
+(2, '2024-01-02 10:00:00', '2024-01-02');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := newDbExplorer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:  "/visits",
+			Query: "where=at:eq:2024-01-01%2010:00:00&fields=id",
+			Result: CR{
+				"response": CR{"records": []CR{CR{"id": 1}}},
+			},
+		},
+		Case{
+			Path:  "/visits",
+			Query: "where=at:gte:2024-01-02T10:00:00Z&fields=id,at",
+			Result: CR{
+				"response": CR{"records": []CR{CR{"id": 2, "at": "2024-01-02T10:00:00Z"}}},
+			},
+		},
+		Case{
+			Path:   "/visits/",
+			Method: http.MethodPut,
+			Body:   CR{"at": "2024-01-03T03:00:00+03:00", "day": "2024-01-03"},
+			Result: CR{
+				"response": CR{"id": 3},
+			},
+		},
+		Case{
+			Path:  "/visits",
+			Query: "where=at:gte:2024-01-02%2010:00:00&sort=-at&fields=id,at",
+			Result: CR{
+				"response": CR{"records": []CR{
+					CR{"id": 3, "at": "2024-01-03T00:00:00Z"},
+					CR{"id": 2, "at": "2024-01-02T10:00:00Z"},
+				}},
+			},
+		},
+		Case{
+			Path:  "/visits",
+			Query: "where=at:lt:2024-01-03T00:00:00Z&where=day:in:2024-01-01|2024-01-03&fields=id",
+			Result: CR{
+				"response": CR{"records": []CR{CR{"id": 1}}},
+			},
+		},
+		Case{
+			Path:  "/visits",
+			Query: "where=day:eq:2024-01-03&fields=id",
+			Result: CR{
+				"response": CR{"records": []CR{CR{"id": 3}}},
+			},
+		},
+	})
+
+	var at string
+	if err = db.QueryRow(`SELECT CAST(at AS TEXT) FROM visits WHERE id = 3`).Scan(&at); err != nil {
+		t.Fatal(err)
+	}
+	if at != "2024-01-03 00:00:00" {
+		t.Fatalf("PUT stored %q, want the format of SQL", at)
+	}
+}
+
+func TestSchemaSQLite(t *testing.T) {
+	db := openSQLite(t)
+	qs := []string{
+		`CREATE TABLE authors (
+  id INTEGER PRIMARY KEY,
+  name varchar(255) NOT NULL
+);`,
+		`CREATE TABLE books (
+  id INTEGER PRIMARY KEY,
+  author_id INTEGER NOT NULL REFERENCES authors,
+  title varchar(255) NOT NULL,
+  isbn varchar(20),
+  status varchar(10) NOT NULL DEFAULT 'draft',
+  price DECIMAL(10,2)
+);`,
+		`CREATE UNIQUE INDEX books_isbn ON books (isbn);`,
+		`CREATE INDEX books_author_title ON books (author_id, title);`,
+		`CREATE TABLE labels (name varchar(255) PRIMARY KEY);`,
+		`INSERT INTO labels (name) VALUES ('_schema');`,
+	}
+	for _, q := range qs {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler, err := newDbExplorer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path: "/books/_schema",
+			Result: CR{
+				"response": CR{
+					"table": "books",
+					"columns": []CR{
+						CR{"field": "id", "type": "INTEGER", "format": "integer", "null": false, "key": "PRI", "default": nil, "auto_increment": true},
+						CR{"field": "author_id", "type": "INTEGER", "format": "integer", "null": false, "key": "", "default": nil, "auto_increment": false},
+						CR{"field": "title", "type": "varchar(255)", "format": "string", "null": false, "key": "", "default": nil, "auto_increment": false},
+						CR{"field": "isbn", "type": "varchar(20)", "format": "string", "null": true, "key": "", "default": nil, "auto_increment": false},
+						CR{"field": "status", "type": "varchar(10)", "format": "string", "null": false, "key": "", "default": "'draft'", "auto_increment": false},
+						CR{"field": "price", "type": "DECIMAL(10,2)", "format": "decimal", "null": true, "key": "", "default": nil, "auto_increment": false},
+					},
+					"primary_key": []string{"id"},
+					"foreign_keys": []CR{
+						CR{"name": "fk_0", "columns": []string{"author_id"}, "ref_table": "authors", "ref_columns": []string{"id"}},
+					},
+					"indexes": []CR{
+						CR{"name": "books_author_title", "columns": []string{"author_id", "title"}, "unique": false},
+						CR{"name": "books_isbn", "columns": []string{"isbn"}, "unique": true},
+					},
+				},
+			},
+		},
+		Case{
+			Path: "/authors/_schema",
+			Result: CR{
+				"response": CR{
+					"table": "authors",
+					"columns": []CR{
+						CR{"field": "id", "type": "INTEGER", "format": "integer", "null": false, "key": "PRI", "default": nil, "auto_increment": true},
+						CR{"field": "name", "type": "varchar(255)", "format": "string", "null": false, "key": "", "default": nil, "auto_increment": false},
+					},
+					"primary_key":  []string{"id"},
+					"foreign_keys": []CR{},
+					"indexes":      []CR{},
+				},
+			},
+		},
+		// a record with the id equal to the route name is reached with the escaped id
+		Case{
+			Path:   "/labels/%5Fschema",
+			Result: CR{"response": CR{"record": CR{"name": "_schema"}}},
+		},
+		Case{
+			Path:   "/_schema",
+			Status: http.StatusNotFound,
+			Result: CR{"error": "unknown table"},
+		},
+		Case{
+			Path:   "/unknown_table/_schema",
+			Status: http.StatusNotFound,
+			Result: CR{"error": "table unknown_table doesn't exist"},
+		},
+	})
+}
+
+func TestReloadSQLite(t *testing.T) {
+	db := openSQLite(t)
+	_, err := db.Exec(`CREATE TABLE notes (id INTEGER PRIMARY KEY, body text NOT NULL);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := newDbExplorer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	// миграция после старта: новая таблица и новая колонка не видны до перезагрузки схемы
+	_, err = db.Exec(`CREATE TABLE tags (id INTEGER PRIMARY KEY, name text NOT NULL);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`ALTER TABLE notes ADD COLUMN title text;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:   "/",
+			Result: CR{"response": CR{"tables": []string{"notes"}}},
+		},
+		Case{
+			Path:   "/tags",
+			Status: http.StatusNotFound,
+			Result: CR{"error": "unknown table"},
+		},
+		Case{
+			Path:   "/notes/",
+			Method: http.MethodPut,
+			Body:   CR{"body": "first", "title": "ignored"},
+			Result: CR{"response": CR{"id": 1}},
+		},
+		Case{
+			Path:   "/_reload",
+			Method: http.MethodPost,
+			Result: CR{"response": CR{"changed": true, "tables": []string{"notes", "tags"}, "skipped": CR{}}},
+		},
+		Case{
+			Path:   "/_reload",
+			Method: http.MethodPost,
+			Result: CR{"response": CR{"changed": false, "tables": []string{"notes", "tags"}, "skipped": CR{}}},
+		},
+		Case{
+			Path:   "/",
+			Result: CR{"response": CR{"tables": []string{"notes", "tags"}}},
+		},
+		Case{
+			Path:   "/tags",
+			Result: CR{"response": CR{"records": []CR{}}},
+		},
+		Case{
+			Path:   "/notes/",
+			Method: http.MethodPut,
+			Body:   CR{"body": "second", "title": "kept"},
+			Result: CR{"response": CR{"id": 2}},
+		},
+		Case{
+			Path: "/notes",
+			Result: CR{"response": CR{"records": []CR{
+				CR{"id": 1, "body": "first", "title": nil},
+				CR{"id": 2, "body": "second", "title": "kept"},
+			}}},
+		},
+		// only /_reload is the admin route, here _reload is the id of a record
+		Case{
+			Path:   "/notes/_reload",
+			Method: http.MethodPost,
+			Status: http.StatusBadRequest,
+			Body:   CR{"title": "x"},
+			Result: CR{"error": "field id have invalid type"},
+		},
+	})
+}
+
+func TestSchemaRefreshSQLite(t *testing.T) {
+	db := openSQLite(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler, err := newDbExplorer(db, withSchemaRefresh(ctx, 10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	_, err = db.Exec(`CREATE TABLE tags (id INTEGER PRIMARY KEY, name text NOT NULL);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		resp, err := client.Get(ts.URL + "/tags")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("table tags is not found after refresh, status %d", resp.StatusCode)
+		}
+	}
+}
+
+// rawRequest returns the status, the content type and the body as is, runCases compares JSON
+// decoded into float64, so it can't tell big numbers apart and can't read CSV
+func rawRequest(t *testing.T, ts *httptest.Server, method, path, contentType, body string) (int, string, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, resp.Header.Get("Content-Type"), string(data)
+}
+
+func TestBigNumbersSQLite(t *testing.T) {
+	db := openSQLite(t)
+	_, err := db.Exec(`CREATE TABLE counters (
+  id INTEGER PRIMARY KEY,
+  big BIGINT NOT NULL,
+  small INT UNSIGNED,
+  price DECIMAL(30,2)
+);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := newDbExplorer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	cases := []struct {
+		method, path, body string
+		status             int
+		expected           string
+	}{
+		// 2^53 + 1 is rounded to 2^53 by float64
+		{http.MethodPut, "/counters/", `{"big": 9007199254740993, "price": 12345.25}`,
+			http.StatusOK, `{"response":{"id":1}}`},
+		{http.MethodGet, "/counters/1", "",
+			http.StatusOK, `{"response":{"record":{"big":9007199254740993,"id":1,"price":"12345.25","small":null}}}`},
+		{http.MethodPost, "/counters/1", `{"big": -9007199254740995}`,
+			http.StatusOK, `{"response":{"updated":1}}`},
+		{http.MethodGet, "/counters/1", "",
+			http.StatusOK, `{"response":{"record":{"big":-9007199254740995,"id":1,"price":"12345.25","small":null}}}`},
+		{http.MethodPost, "/counters/1", `{"big": 9223372036854775808}`,
+			http.StatusBadRequest, `{"error":"field big have invalid type"}`},
+		{http.MethodPost, "/counters/1", `{"small": 18446744073709551616}`,
+			http.StatusBadRequest, `{"error":"field small have invalid type"}`},
+		{http.MethodPost, "/counters/1", `{"small": -1}`,
+			http.StatusBadRequest, `{"error":"field small have invalid type"}`},
+		{http.MethodPost, "/counters/1", `{"big": 1.5}`,
+			http.StatusBadRequest, `{"error":"field big have invalid type"}`},
+		{http.MethodPost, "/counters/1", `{"big": 1e3}`,
+			http.StatusOK, `{"response":{"updated":1}}`},
+		{http.MethodGet, "/counters/1", "",
+			http.StatusOK, `{"response":{"record":{"big":1000,"id":1,"price":"12345.25","small":null}}}`},
+	}
+	for _, c := range cases {
+		status, _, body := rawRequest(t, ts, c.method, c.path, "application/json", c.body)
+		if status != c.status || body != c.expected {
+			t.Fatalf("[%s %s %s] expected %d %s, got %d %s", c.method, c.path, c.body, c.status, c.expected, status, body)
+		}
+	}
+}
+
+// brokenDialect fails to read columns of one table, SQLite itself has no unreadable tables
+type brokenDialect struct {
+	sqliteDialect
+	table string
+}
+
+func (d brokenDialect) columns(ctx context.Context, db *sql.DB, table string) ([]*columnInfo, error) {
+	if table == d.table {
+		return nil, errors.New("permission denied")
+	}
+	return d.sqliteDialect.columns(ctx, db, table)
+}
+
+func TestLoadSchemaErrorsSQLite(t *testing.T) {
+	db := openSQLite(t)
+	_, err := db.Exec(`CREATE TABLE notes (id INTEGER PRIMARY KEY, body text NOT NULL);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE secrets (id INTEGER PRIMARY KEY, body text NOT NULL);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := &dBExplorer{db: db, dialect: brokenDialect{table: "secrets"}}
+	_, _, err = exp.loadDBInfo()
+	if err == nil || err.Error() != "read columns of table secrets: permission denied" {
+		t.Fatalf("expected error of table secrets, got %v", err)
+	}
+
+	exp.skipUnreadable = true
+	tables, skipped, err := exp.loadDBInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tables["notes"]; !ok || len(tables) != 1 {
+		t.Fatalf("expected only table notes, got %v", tables)
+	}
+	if len(skipped) != 1 || skipped["secrets"] == nil {
+		t.Fatalf("expected table secrets to be skipped, got %v", skipped)
+	}
+
+	_, err = newDbExplorer(db, withSchemaTimeout(time.Nanosecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+}
+
+func TestBulkSQLite(t *testing.T) {
+	db := openSQLite(t)
+	_, err := db.Exec(`CREATE TABLE notes (
+  id INTEGER PRIMARY KEY,
+  title varchar(255) NOT NULL,
+  code varchar(10) UNIQUE,
+  views INTEGER NOT NULL DEFAULT 0
+);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := newDbExplorer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:   "/notes/_bulk",
+			Method: http.MethodPost,
+			Body: CR{"ops": []CR{
+				CR{"op": "create", "record": CR{"title": "first", "code": "a"}},
+				CR{"op": "create", "record": CR{"title": "second", "code": "b"}},
+				CR{"op": "create", "record": CR{"title": "third"}},
+				CR{"op": "update", "key": CR{"id": 1}, "record": CR{"views": 5}},
+				CR{"op": "delete", "key": CR{"id": 3}},
+			}},
+			Result: CR{"response": CR{
+				"committed": true,
+				"results": []CR{
+					CR{"op": "create", "status": 200, "key": CR{"id": 1}},
+					CR{"op": "create", "status": 200, "key": CR{"id": 2}},
+					CR{"op": "create", "status": 200, "key": CR{"id": 3}},
+					CR{"op": "update", "status": 200, "key": CR{"id": 1}, "updated": 1},
+					CR{"op": "delete", "status": 200, "key": CR{"id": 3}, "deleted": 1},
+				},
+			}},
+		},
+		// ошибка в середине откатывает всё, что было до неё
+		Case{
+			Path:   "/notes/_bulk",
+			Method: http.MethodPost,
+			Status: http.StatusBadRequest,
+			Body: CR{"ops": []CR{
+				CR{"op": "delete", "key": CR{"id": 1}},
+				CR{"op": "update", "key": CR{"id": 2}, "record": CR{"views": "many"}},
+				CR{"op": "delete", "key": CR{"id": 2}},
+			}},
+			Result: CR{
+				"error": "op 1: field views have invalid type",
+				"response": CR{
+					"committed": false,
+					"results": []CR{
+						CR{"op": "delete", "status": 200, "key": CR{"id": 1}, "deleted": 1},
+						CR{"op": "update", "status": 400, "error": "field views have invalid type"},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/notes/_bulk",
+			Method: http.MethodPost,
+			Status: http.StatusInternalServerError,
+			Body: CR{"mode": "all_or_nothing", "ops": []CR{
+				CR{"op": "create", "record": CR{"title": "fourth", "code": "c"}},
+				CR{"op": "create", "record": CR{"title": "copy", "code": "a"}},
+			}},
+			Result: CR{
+				"error": "op 1: constraint failed: UNIQUE constraint failed: notes.code (2067)",
+				"response": CR{
+					"committed": false,
+					"results": []CR{
+						CR{"op": "create", "status": 200, "key": CR{"id": 3}},
+						CR{"op": "create", "status": 500, "error": "constraint failed: UNIQUE constraint failed: notes.code (2067)"},
+					},
+				},
+			},
+		},
+		Case{
+			Path: "/notes",
+			Result: CR{"response": CR{"records": []CR{
+				CR{"id": 1, "title": "first", "code": "a", "views": 5},
+				CR{"id": 2, "title": "second", "code": "b", "views": 0},
+			}}},
+		},
+		// то, что не получилось, пропускается, остальное сохраняется
+		Case{
+			Path:   "/notes/_bulk",
+			Method: http.MethodPost,
+			Body: CR{"mode": "best_effort", "ops": []CR{
+				CR{"op": "create", "record": CR{"title": "copy", "code": "a"}},
+				CR{"op": "create", "record": CR{"title": "fourth", "code": "d"}},
+				CR{"op": "update", "key": CR{"id": 2}, "record": CR{"id": 7}},
+				CR{"op": "update", "key": CR{"id": 2}, "record": CR{"title": "second!"}},
+				CR{"op": "delete", "key": CR{}},
+				CR{"op": "delete", "key": CR{"id": 100}},
+				CR{"op": "rename", "key": CR{"id": 1}},
+			}},
+			Result: CR{"response": CR{
+				"committed": true,
+				"results": []CR{
+					CR{"op": "create", "status": 500, "error": "constraint failed: UNIQUE constraint failed: notes.code (2067)"},
+					CR{"op": "create", "status": 200, "key": CR{"id": 3}},
+					CR{"op": "update", "status": 400, "error": "field id have invalid type"},
+					CR{"op": "update", "status": 200, "key": CR{"id": 2}, "updated": 1},
+					CR{"op": "delete", "status": 400, "error": "key field id is missing"},
+					CR{"op": "delete", "status": 200, "key": CR{"id": 100}, "deleted": 0},
+					CR{"op": "rename", "status": 400, "error": "unknown op rename"},
+				},
+			}},
+		},
+		Case{
+			Path: "/notes",
+			Result: CR{"response": CR{"records": []CR{
+				CR{"id": 1, "title": "first", "code": "a", "views": 5},
+				CR{"id": 2, "title": "second!", "code": "b", "views": 0},
+				CR{"id": 3, "title": "fourth", "code": "d", "views": 0},
+			}}},
+		},
+		Case{
+			Path:   "/notes/_bulk",
+			Method: http.MethodPost,
+			Status: http.StatusBadRequest,
+			Body:   CR{"mode": "sometimes", "ops": []CR{}},
+			Result: CR{"error": "unknown mode sometimes"},
+		},
+		Case{
+			Path:   "/unknown_table/_bulk",
+			Method: http.MethodPost,
+			Status: http.StatusNotFound,
+			Body:   CR{"ops": []CR{}},
+			Result: CR{"error": "table unknown_table doesn't exist"},
+		},
+	})
+}
+
+func TestExportImportSQLite(t *testing.T) {
+	db := openSQLite(t)
+	_, err := db.Exec(`CREATE TABLE notes (
+  id INTEGER PRIMARY KEY,
+  title varchar(255) NOT NULL,
+  views INTEGER NOT NULL DEFAULT 0,
+  rating FLOAT,
+  meta JSON,
+  note text
+);
+CREATE TABLE drafts (id INTEGER PRIMARY KEY, body text);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := newDbExplorer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	check := func(method, path, contentType, body string, status int, expectedType, expected string) {
+		t.Helper()
+		gotStatus, gotType, got := rawRequest(t, ts, method, path, contentType, body)
+		if gotStatus != status || gotType != expectedType || got != expected {
+			t.Fatalf("[%s %s] expected %d %s\n%s\ngot %d %s\n%s", method, path, status, expectedType, expected, gotStatus, gotType, got)
+		}
+	}
+
+	check(http.MethodPost, "/notes/_import", "text/csv", `title,views,rating,meta,note
+first,3,4.5,"{""tags"":[""a""]}","with, comma"
+second,,,,
+"multi
+line",1,0.5,null,""
+`, http.StatusOK, "application/json", `{"response":{"imported":3}}`)
+
+	check(http.MethodPost, "/notes/_import?format=ndjson", "application/octet-stream", `{"title": "fourth", "views": 10}
+
+{"title": "fifth", "meta": {"n": 1}, "id": 100}
+`, http.StatusOK, "application/json", `{"response":{"imported":2}}`)
+
+	// первая ошибка откатывает весь импорт
+	check(http.MethodPost, "/notes/_import", "text/csv", "title,views\nsixth,1\nseventh,many\n",
+		http.StatusBadRequest, "application/json", `{"error":"line 3: field views have invalid type"}`)
+	check(http.MethodPost, "/notes/_import", "application/x-ndjson", "{\"title\": \"sixth\"}\n{\"title\": null}\n",
+		http.StatusBadRequest, "application/json", `{"error":"line 2: field title have invalid type"}`)
+	check(http.MethodPost, "/notes/_import", "text/csv", "title,author\nsixth,me\n",
+		http.StatusBadRequest, "application/json", `{"error":"unknown field author"}`)
+	check(http.MethodPost, "/notes/_import", "text/csv", "title,views\nsixth\n",
+		http.StatusBadRequest, "application/json", `{"error":"line 2: wrong number of fields"}`)
+	check(http.MethodPost, "/notes/_import", "application/json", `{"title": "sixth"}`,
+		http.StatusBadRequest, "application/json", `{"error":"unknown format, use ?format=csv or ?format=ndjson"}`)
+
+	check(http.MethodGet, "/notes?format=csv", "", "", http.StatusOK, "text/csv; charset=utf-8", `id,title,views,rating,meta,note
+1,first,3,4.5,"{""tags"":[""a""]}","with, comma"
+2,second,0,,,
+3,"multi
+line",1,0.5,,
+4,fourth,10,,,
+100,fifth,0,,"{""n"":1}",
+`)
+
+	// ключи из файла сохраняются, а новые записи получают следующие за ними
+	check(http.MethodPut, "/notes/", "application/json", `{"title": "sixth"}`, http.StatusOK, "application/json", `{"response":{"id":101}}`)
+
+	check(http.MethodGet, "/notes?format=ndjson&fields=id,title,meta&where=views:gte:3&sort=-views", "", "", http.StatusOK, "application/x-ndjson", `{"id":4,"meta":null,"title":"fourth"}
+{"id":1,"meta":{"tags":["a"]},"title":"first"}
+`)
+
+	check(http.MethodGet, "/notes?format=csv&limit=2&offset=1&fields=title", "", "", http.StatusOK, "text/csv; charset=utf-8", "title\nsecond\n\"multi\nline\"\n")
+	check(http.MethodGet, "/notes?format=xml", "", "", http.StatusBadRequest, "application/json", `{"error":"unknown format xml"}`)
+	check(http.MethodGet, "/notes?format=csv&count=true", "", "", http.StatusBadRequest, "application/json", `{"error":"format csv can't be used with cursor or count"}`)
+
+	// ошибка до первой строки отдаётся обычным JSON, а не файлом
+	if _, err = db.Exec(`DROP TABLE drafts`); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(ts.URL + "/drafts?format=csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError || resp.Header.Get("Content-Type") != "application/json" ||
+		resp.Header.Get("Content-Disposition") != "" {
+		t.Fatalf("failed export: status %d, headers %v", resp.StatusCode, resp.Header)
+	}
+}
+
+func TestCSVRoundTripSQLite(t *testing.T) {
+	db := openSQLite(t)
+	_, err := db.Exec(`CREATE TABLE counters (
+  id INTEGER PRIMARY KEY,
+  big BIGINT NOT NULL,
+  note text
+);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := newDbExplorer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	check := func(method, path, body string, status int, expected string) {
+		t.Helper()
+		gotStatus, _, got := rawRequest(t, ts, method, path, "text/csv", body)
+		if gotStatus != status || got != expected {
+			t.Fatalf("[%s %s] expected %d\n%s\ngot %d\n%s", method, path, status, expected, gotStatus, got)
+		}
+	}
+
+	// \N - это NULL, пустое значение - пустая строка
+	check(http.MethodPost, "/counters/_import?null=%5CN", "big,note\n9007199254740993,\n-9007199254740995,\\N\n",
+		http.StatusOK, `{"response":{"imported":2}}`)
+
+	exported := "id,big,note\n1,9007199254740993,\n2,-9007199254740995,\\N\n"
+	check(http.MethodGet, "/counters?format=csv&null=%5CN", "", http.StatusOK, exported)
+	// без null их не различить
+	check(http.MethodGet, "/counters?format=csv", "", http.StatusOK, "id,big,note\n1,9007199254740993,\n2,-9007199254740995,\n")
+
+	// выгрузка загружается обратно без потерь, вместе с id
+	if _, err = db.Exec(`DELETE FROM counters`); err != nil {
+		t.Fatal(err)
+	}
+	check(http.MethodPost, "/counters/_import?null=%5CN", exported, http.StatusOK, `{"response":{"imported":2}}`)
+	check(http.MethodGet, "/counters?format=csv&null=%5CN", "", http.StatusOK, exported)
+
+	// пустой id заполняет база
+	check(http.MethodPost, "/counters/_import", "id,big,note\n,7,new\n", http.StatusOK, `{"response":{"imported":1}}`)
+	check(http.MethodGet, "/counters?format=csv&where=big:eq:7", "", http.StatusOK, "id,big,note\n3,7,new\n")
+
+	check(http.MethodPost, "/counters/_import", "big\n9223372036854775808\n",
+		http.StatusBadRequest, `{"error":"line 2: field big have invalid type"}`)
+	check(http.MethodPost, "/counters/_import", "big\n1.5\n",
+		http.StatusBadRequest, `{"error":"line 2: field big have invalid type"}`)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// typeKind groups SQL types of all dialects by the way they look in JSON:
+// times are RFC 3339 strings, decimals are strings to keep precision, blobs are base64 strings
+type typeKind int
+
+const (
+	kindString typeKind = iota // also enums, uuids and anything unknown
+	kindInt
+	kindUint
+	kindFloat
+	kindDecimal
+	kindBool
+	kindDateTime
+	kindDate
+	kindJSON
+	kindBlob
+)
+
+func columnKind(typeName string) typeKind {
+	upper := strings.ToUpper(typeName)
+	base := baseType(typeName)
+	unsigned := strings.Contains(upper, "UNSIGNED")
+
+	// MySQL has no real bool, it's tinyint(1)
+	if base == "BOOL" || base == "BOOLEAN" || strings.HasPrefix(upper, "TINYINT(1)") {
+		return kindBool
+	}
+
+	switch base {
+	case "INT", "INTEGER", "TINYINT", "SMALLINT", "MEDIUMINT", "BIGINT", "INT2", "INT4", "INT8", "BIG INT", "UNSIGNED BIG INT",
+		"SERIAL", "SMALLSERIAL", "BIGSERIAL", "SERIAL2", "SERIAL4", "SERIAL8", "YEAR":
+		if unsigned {
+			return kindUint
+		}
+		return kindInt
+	case "FLOAT", "FLOAT4", "FLOAT8", "DOUBLE", "DOUBLE PRECISION", "REAL":
+		return kindFloat
+	case "DECIMAL", "NUMERIC", "DEC", "FIXED":
+		return kindDecimal
+	case "DATETIME", "TIMESTAMP", "TIMESTAMPTZ", "TIMESTAMP WITHOUT TIME ZONE", "TIMESTAMP WITH TIME ZONE":
+		return kindDateTime
+	case "DATE":
+		return kindDate
+	case "JSON", "JSONB":
+		return kindJSON
+	case "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY", "BYTEA":
+		return kindBlob
+	}
+	return kindString
+}
+
+// enumValues returns allowed values of MySQL's enum('a','b'), nil for other types
+func enumValues(typeName string) []string {
+	if baseType(typeName) != "ENUM" {
+		return nil
+	}
+
+	list := typeName[strings.IndexByte(typeName, '(')+1 : strings.LastIndexByte(typeName, ')')]
+	values := make([]string, 0)
+	for _, quoted := range strings.Split(list, "','") {
+		values = append(values, strings.Replace(strings.Trim(quoted, "'"), "''", "'", -1))
+	}
+	return values
+}
+
+var timeFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+func parseTime(s string) (time.Time, bool) {
+	for _, layout := range timeFormats {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// timeValue reads dates and times, MySQL without parseTime=true and SQLite may return them as text
+type timeValue struct {
+	time  time.Time
+	raw   string // text which isn't a time, e.g. MySQL's zero date
+	valid bool
+	date  bool
+}
+
+func (t *timeValue) Scan(src interface{}) error {
+	t.valid = src != nil
+	t.raw = ""
+
+	switch v := src.(type) {
+	case nil:
+	case time.Time:
+		t.time = v
+	case int64:
+		t.time = time.Unix(v, 0).UTC()
+	case []byte:
+		t.scanText(string(v))
+	case string:
+		t.scanText(v)
+	default:
+		return fmt.Errorf("can't read %T as time", src)
+	}
+	return nil
+}
+
+func (t *timeValue) scanText(s string) {
+	var ok bool
+	if t.time, ok = parseTime(s); !ok {
+		t.raw = s
+	}
+}
+
+func (t *timeValue) value() interface{} {
+	switch {
+	case !t.valid:
+		return nil
+	case t.raw != "":
+		return t.raw
+	case t.date:
+		return t.time.Format("2006-01-02")
+	}
+	return t.time.Format(time.RFC3339Nano)
+}
+
+// jsonValue keeps JSON columns as they are, so they are objects in the response, not strings
+type jsonValue struct {
+	raw   json.RawMessage
+	valid bool
+}
+
+func (j *jsonValue) Scan(src interface{}) error {
+	j.valid = src != nil
+
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = append([]byte{}, v...)
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("can't read %T as json", src)
+	}
+
+	// broken documents are returned as strings
+	if !json.Valid(data) {
+		data, _ = json.Marshal(string(data))
+	}
+	j.raw = data
+	return nil
+}
+
+// uintValue is read as text, big unsigned numbers don't fit int64
+type uintValue struct {
+	sql.NullString
+}
+
+// floatValue returns NaN and infinities as strings, JSON has no such numbers
+func floatValue(f float64) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return f
+}
+
+// parseValue converts a value from the URL to a query parameter of the column
+func parseValue(col *columnInfo, raw string, d dialect) (interface{}, error) {
+	var val interface{}
+	var err error
+
+	switch columnKind(col.typeName) {
+	case kindInt:
+		val, err = strconv.ParseInt(raw, 10, 64)
+	case kindUint:
+		val, err = strconv.ParseUint(raw, 10, 64)
+	case kindFloat:
+		val, err = strconv.ParseFloat(raw, 64)
+	case kindDecimal:
+		val = raw
+		_, err = strconv.ParseFloat(raw, 64)
+	case kindBool:
+		val, err = strconv.ParseBool(raw)
+	case kindDateTime, kindDate:
+		t, ok := parseTime(raw)
+		if !ok {
+			err = fmt.Errorf("invalid time %s", raw)
+		}
+		val = d.timeParam(t, columnKind(col.typeName) == kindDate)
+	case kindBlob:
+		val, err = base64.StdEncoding.DecodeString(raw)
+	default:
+		val = raw
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("field %s have invalid type", col.field)
+	}
+	return val, nil
+}
+
+// jsonInt parses integers exactly, 1e3 and 5.0 are accepted as well while they fit float64 exactly
+func jsonInt(n json.Number) (int64, error) {
+	i, err := strconv.ParseInt(n.String(), 10, 64)
+	if err == nil {
+		return i, nil
+	}
+
+	f, ferr := n.Float64()
+	if ferr != nil || f != math.Trunc(f) || math.Abs(f) > 1<<53 {
+		return 0, err
+	}
+	return int64(f), nil
+}
+
+func jsonUint(n json.Number) (uint64, error) {
+	u, err := strconv.ParseUint(n.String(), 10, 64)
+	if err == nil {
+		return u, nil
+	}
+
+	f, ferr := n.Float64()
+	if ferr != nil || f != math.Trunc(f) || f < 0 || f > 1<<53 {
+		return 0, err
+	}
+	return uint64(f), nil
+}
+
+// dbValue converts a value from the JSON body, decoded with json.Number and checked by compareTypes, to the type of the column
+func dbValue(col *columnInfo, val interface{}, d dialect) (interface{}, error) {
+	if val == nil {
+		return nil, nil
+	}
+
+	if n, ok := val.(json.Number); ok {
+		switch columnKind(col.typeName) {
+		case kindInt:
+			return jsonInt(n)
+		case kindUint:
+			return jsonUint(n)
+		case kindFloat:
+			return n.Float64()
+		case kindDecimal:
+			// the text is kept, so the precision is the one of the column, not of float64
+			return n.String(), nil
+		case kindBool:
+			return n.String() == "1", nil
+		}
+	}
+
+	switch columnKind(col.typeName) {
+	case kindDateTime, kindDate:
+		if s, ok := val.(string); ok {
+			if t, ok := parseTime(s); ok {
+				return d.timeParam(t, columnKind(col.typeName) == kindDate), nil
+			}
+		}
+	case kindJSON:
+		data, err := json.Marshal(val)
+		return string(data), err
+	case kindBlob:
+		if s, ok := val.(string); ok {
+			return base64.StdEncoding.DecodeString(s)
+		}
+	}
+
+	return val, nil
+}